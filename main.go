@@ -1,15 +1,37 @@
 package main
 
 import (
+	"be-golang-todo/src/helper/account"
 	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/mailer"
+	"be-golang-todo/src/helper/metrics"
+	"be-golang-todo/src/helper/password"
 	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/storage"
+	"be-golang-todo/src/helper/tracing"
 	"be-golang-todo/src/middlewares"
+	"be-golang-todo/src/services/admin"
+	"be-golang-todo/src/services/attachment"
+	"be-golang-todo/src/services/caldav"
+	"be-golang-todo/src/services/calendar"
+	"be-golang-todo/src/services/comment"
+	"be-golang-todo/src/services/mfa"
+	"be-golang-todo/src/services/notification"
+	"be-golang-todo/src/services/oidc"
 	"be-golang-todo/src/services/task"
+	"be-golang-todo/src/services/timeentry"
+	"be-golang-todo/src/services/token"
 	"be-golang-todo/src/services/user"
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -18,31 +40,147 @@ import (
 
 // Initialize PostgreSQL and Redis clients
 func init() {
+	logging.Init()
+	tracing.Init()
+
 	database.Init()
-	log.Println("Connected to postgresql")
+	slog.Info("Connected to postgresql")
 
 	config.InitRedis()
-	log.Println("Connected to redis")
+	slog.Info("Connected to redis")
+
+	storage.Init()
+	slog.Info("Blob store ready")
+
+	mailer.Init()
+	slog.Info("Mailer ready")
+
+	password.Init()
+
+	metrics.Init()
+
+	task.OnPurge(attachment.DeleteTaskAttachments)
 }
 
+// Default rate limits, each can be changed with RATE_LIMIT_<NAME>
+var (
+	loginLimit    = middlewares.Limit{Name: "login", Requests: 10, Window: time.Minute, Key: middlewares.ByIP}
+	registerLimit = middlewares.Limit{Name: "register", Requests: 5, Window: time.Hour, Key: middlewares.ByIP}
+	emailLimit    = middlewares.Limit{Name: "email", Requests: 10, Window: time.Hour, Key: middlewares.ByIP}
+	tasksLimit    = middlewares.Limit{Name: "tasks", Requests: 300, Window: time.Minute, Key: middlewares.ByClient}
+	davLimit      = middlewares.Limit{Name: "caldav", Requests: 300, Window: time.Minute, Key: middlewares.ByIP}
+)
+
 func main() {
 	router := httprouter.New()
-	router.POST("/login", user.LoginUserHandler)
-	router.POST("/register", user.CreateUserHandler)
+	router.Handler("GET", "/metrics", metrics.Handler())
+	router.POST("/login", middlewares.RateLimit(loginLimit, user.LoginUserHandler))
+	router.POST("/register", middlewares.RateLimit(registerLimit, user.CreateUserHandler))
+	router.POST("/login/mfa", middlewares.RateLimit(loginLimit, mfa.LoginMFAHandler))
+	router.GET("/oidc/:provider/login", oidc.LoginHandler)
+	router.GET("/oidc/:provider/callback", oidc.CallbackHandler)
+	router.POST("/email/verify", middlewares.RateLimit(emailLimit, user.VerifyEmailHandler))
+	router.POST("/email/verification", middlewares.ProtectedHandler(user.ResendVerificationEmailHandler))
+	router.POST("/password/forgot", middlewares.RateLimit(emailLimit, user.ForgotPasswordHandler))
+	router.POST("/password/reset", middlewares.RateLimit(emailLimit, user.ResetPasswordHandler))
+	router.GET("/me", middlewares.ProtectedHandler(user.GetMeHandler))
+	router.PATCH("/me", middlewares.ProtectedHandler(user.UpdateMeHandler))
+	router.DELETE("/me", middlewares.ProtectedHandler(user.DeleteMeHandler))
+	router.POST("/me/password", middlewares.ProtectedHandler(user.ChangePasswordHandler))
+	router.GET("/me/sessions", middlewares.ProtectedHandler(user.GetSessionsHandler))
+	router.DELETE("/me/sessions/:id", middlewares.ProtectedHandler(user.RevokeSessionHandler))
+	router.GET("/mfa", middlewares.ProtectedHandler(mfa.GetMFAStatusHandler))
+	router.POST("/mfa/totp", middlewares.ProtectedHandler(mfa.EnrollTOTPHandler))
+	router.POST("/mfa/totp/verify", middlewares.ProtectedHandler(mfa.VerifyTOTPHandler))
+	router.DELETE("/mfa/totp", middlewares.ProtectedHandler(mfa.DisableTOTPHandler))
+	router.POST("/mfa/recovery-codes", middlewares.ProtectedHandler(mfa.RegenerateRecoveryCodesHandler))
 	// router.GET("/tasks/all", middlewares.ProtectedHandler(todo.GetAllTodosHandler))
-	router.GET("/tasks", middlewares.ProtectedHandler(task.GetAllTaskPaginationHandler))
-	router.GET("/tasks/:id", middlewares.ProtectedHandler(task.GetDetailTaskHandler))
-	router.PUT("/tasks/:id", middlewares.ProtectedHandler(task.UpdateTaskHandler))
-	router.DELETE("/tasks/:id", middlewares.ProtectedHandler(task.DeleteTaskHandler))
-	router.POST("/tasks", middlewares.ProtectedHandler(task.CreateTaskHandler))
+	router.GET("/tasks", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.GetAllTaskPaginationHandler)))
+	router.GET("/tasks/:id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, middlewares.StaticSegment("id", "export", task.ExportTasksHandler, task.GetDetailTaskHandler))))
+	router.POST("/tasks/:id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, middlewares.StaticSegment("id", "import", task.ImportTasksHandler, nil))))
+	router.PUT("/tasks/:id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.UpdateTaskHandler)))
+	router.PATCH("/tasks/:id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.UpdateTaskHandler)))
+	router.DELETE("/tasks/:id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.DeleteTaskHandler)))
+	router.POST("/tasks", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.CreateTaskHandler)))
+	router.POST("/tasks/:id/move", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.MoveTaskHandler)))
+	router.POST("/tasks/:id/assignees", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.AssignTaskHandler)))
+	router.DELETE("/tasks/:id/assignees/:username", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.UnassignTaskHandler)))
+	router.GET("/tasks/:id/comments", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, comment.GetTaskCommentsHandler)))
+	router.POST("/tasks/:id/comments", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, comment.CreateCommentHandler)))
+	router.PUT("/tasks/:id/comments/:comment_id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, comment.UpdateCommentHandler)))
+	router.DELETE("/tasks/:id/comments/:comment_id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, comment.DeleteCommentHandler)))
+	router.GET("/tasks/:id/attachments", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, attachment.GetTaskAttachmentsHandler)))
+	router.POST("/tasks/:id/attachments", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, attachment.UploadAttachmentHandler)))
+	router.DELETE("/tasks/:id/attachments/:attachment_id", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, attachment.DeleteAttachmentHandler)))
+	router.GET("/attachments/:id", attachment.DownloadAttachmentHandler)
+	router.POST("/tasks/:id/timer/start", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, timeentry.StartTimerHandler)))
+	router.POST("/tasks/:id/timer/stop", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, timeentry.StopTimerHandler)))
+	router.GET("/tasks/:id/time-entries", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, timeentry.GetTaskTimeEntriesHandler)))
+	router.POST("/tasks/:id/time-entries", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, timeentry.CreateTimeEntryHandler)))
+	router.DELETE("/time-entries/:id", middlewares.ProtectedHandler(timeentry.DeleteTimeEntryHandler))
+	router.GET("/timer", middlewares.ProtectedHandler(timeentry.GetRunningTimerHandler))
+	router.GET("/reports/time", middlewares.ProtectedHandler(timeentry.GetTimeReportHandler))
+	router.POST("/calendar/token", middlewares.ProtectedHandler(calendar.RegenerateCalendarTokenHandler))
+	router.DELETE("/calendar/token", middlewares.ProtectedHandler(calendar.RevokeCalendarTokenHandler))
+	router.GET("/calendar/:token", calendar.CalendarFeedHandler)
+	davHandler := caldav.Handler()
+	davHandle := middlewares.RateLimit(davLimit, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		davHandler.ServeHTTP(w, r)
+	})
+	for _, method := range caldav.Methods {
+		router.Handle(method, caldav.Prefix+"/*path", davHandle)
+	}
+	router.Handle("GET", "/.well-known/caldav", davHandle)
+	router.Handle("PROPFIND", "/.well-known/caldav", davHandle)
+	router.GET("/sync", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.GetSyncHandler)))
+	router.POST("/sync", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.PostSyncHandler)))
+	router.GET("/board", middlewares.ProtectedHandler(middlewares.RateLimit(tasksLimit, task.GetBoardHandler)))
+	router.GET("/tokens", middlewares.ProtectedHandler(token.GetTokensHandler))
+	router.POST("/tokens", middlewares.ProtectedHandler(token.CreateTokenHandler))
+	router.GET("/tokens/:id", middlewares.ProtectedHandler(token.GetTokenHandler))
+	router.PATCH("/tokens/:id", middlewares.ProtectedHandler(token.UpdateTokenHandler))
+	router.DELETE("/tokens/:id", middlewares.ProtectedHandler(token.DeleteTokenHandler))
+	router.GET("/admin/users", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.ListUsersHandler)))
+	router.POST("/admin/users/:id/disable", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.DisableUserHandler)))
+	router.POST("/admin/users/:id/enable", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.EnableUserHandler)))
+	router.PUT("/admin/users/:id/role", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.SetUserRoleHandler)))
+	router.POST("/admin/users/:id/password", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.ResetPasswordHandler)))
+	router.DELETE("/admin/users/:id", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.DeleteUserHandler)))
+	router.GET("/admin/audit", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.GetAuditLogHandler)))
+	router.GET("/admin/stats", middlewares.ProtectedHandler(middlewares.RequireRole(account.RoleAdmin, admin.GetStatsHandler)))
+	router.GET("/notifications", middlewares.ProtectedHandler(notification.GetNotificationsHandler))
+	router.POST("/notifications/:id/read", middlewares.ProtectedHandler(notification.MarkNotificationReadHandler))
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	fmt.Printf("Server is running on port %s...\n", port)
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	server := &http.Server{Addr: ":" + port, Handler: tracing.Handler(middlewares.AccessLog(router))}
+
+	// On SIGINT or SIGTERM the requests in flight are finished, then the buffered spans exported
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		slog.Info("Shutting down...")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Error("server shutdown failed", "error", err)
+		}
+		if err := tracing.Shutdown(ctx); err != nil {
+			slog.Error("tracer shutdown failed", "error", err)
+		}
+		close(stopped)
+	}()
+
+	slog.Info(fmt.Sprintf("Server is running on port %s...", port))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		tracing.Shutdown(context.Background())
 		log.Fatal("Failed to start server:", err)
 	}
+	<-stopped
 }
@@ -0,0 +1,5 @@
+-- Task priority (P0 highest .. P4 lowest) and manual per-column ordering.
+ALTER TABLE task ADD COLUMN IF NOT EXISTS priority varchar NOT NULL DEFAULT 'P2';
+ALTER TABLE task ADD COLUMN IF NOT EXISTS position varchar;
+
+CREATE INDEX IF NOT EXISTS task_status_position_idx ON task (status, position COLLATE "C");
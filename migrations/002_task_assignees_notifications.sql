@@ -0,0 +1,22 @@
+-- Task assignment to other users and the in-app notification feed.
+CREATE TABLE IF NOT EXISTS task_assignee (
+    task_id     integer NOT NULL REFERENCES task (id) ON DELETE CASCADE,
+    username    varchar NOT NULL,
+    assigned_at timestamp NOT NULL DEFAULT now(),
+    assigned_by varchar,
+    PRIMARY KEY (task_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS task_assignee_username_idx ON task_assignee (username);
+
+CREATE TABLE IF NOT EXISTS notification (
+    id         serial PRIMARY KEY,
+    username   varchar NOT NULL,
+    type       varchar NOT NULL,
+    task_id    integer REFERENCES task (id) ON DELETE CASCADE,
+    message    varchar NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    read_at    timestamp
+);
+
+CREATE INDEX IF NOT EXISTS notification_username_idx ON notification (username, created_at DESC);
@@ -0,0 +1,13 @@
+-- Threaded Markdown comments on tasks.
+CREATE TABLE IF NOT EXISTS comment (
+    id         serial PRIMARY KEY,
+    task_id    integer NOT NULL REFERENCES task (id) ON DELETE CASCADE,
+    parent_id  integer REFERENCES comment (id) ON DELETE CASCADE,
+    author     varchar NOT NULL,
+    body       varchar NOT NULL,
+    created_at timestamp NOT NULL DEFAULT now(),
+    updated_at timestamp,
+    deleted_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS comment_task_id_idx ON comment (task_id, created_at);
@@ -0,0 +1,15 @@
+-- File attachments on tasks. Blobs are content addressed by their SHA-256,
+-- so identical uploads share one blob in the store.
+CREATE TABLE IF NOT EXISTS attachment (
+    id           serial PRIMARY KEY,
+    task_id      integer NOT NULL REFERENCES task (id) ON DELETE CASCADE,
+    filename     varchar NOT NULL,
+    content_type varchar NOT NULL,
+    size         bigint NOT NULL,
+    sha256       varchar NOT NULL,
+    uploaded_by  varchar NOT NULL,
+    created_at   timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS attachment_task_id_idx ON attachment (task_id);
+CREATE INDEX IF NOT EXISTS attachment_sha256_idx ON attachment (sha256);
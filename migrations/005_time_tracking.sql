@@ -0,0 +1,19 @@
+-- Time tracking: estimates on tasks, running timers and logged work.
+ALTER TABLE task ADD COLUMN IF NOT EXISTS estimate_minutes integer;
+
+CREATE TABLE IF NOT EXISTS time_entry (
+    id         serial PRIMARY KEY,
+    task_id    integer NOT NULL REFERENCES task (id) ON DELETE CASCADE,
+    username   varchar NOT NULL,
+    started_at timestamp NOT NULL,
+    ended_at   timestamp,
+    note       varchar,
+    source     varchar NOT NULL DEFAULT 'timer',
+    created_at timestamp NOT NULL DEFAULT now(),
+    CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+
+-- A running timer is an entry without ended_at, at most one per user
+CREATE UNIQUE INDEX IF NOT EXISTS time_entry_running_idx ON time_entry (username) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS time_entry_task_id_idx ON time_entry (task_id);
+CREATE INDEX IF NOT EXISTS time_entry_username_started_at_idx ON time_entry (username, started_at);
@@ -0,0 +1,4 @@
+-- Secret token of the per-user iCalendar feed, stored as a SHA-256 hash.
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS calendar_token_hash varchar;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_calendar_token_hash_idx ON "user" (calendar_token_hash);
@@ -0,0 +1,5 @@
+-- CalDAV resources created by clients keep their own UID and resource name.
+ALTER TABLE task ADD COLUMN IF NOT EXISTS ical_uid varchar;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS caldav_name varchar;
+
+CREATE INDEX IF NOT EXISTS task_caldav_name_idx ON task (caldav_name);
@@ -0,0 +1,44 @@
+-- Delta sync: every write to a task takes the next number of a global change sequence.
+-- field_seq records, per synced field, the change that last modified it.
+CREATE SEQUENCE IF NOT EXISTS task_change_seq;
+
+ALTER TABLE task ADD COLUMN IF NOT EXISTS change_seq bigint;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS field_seq jsonb NOT NULL DEFAULT '{}';
+
+UPDATE task SET change_seq = nextval('task_change_seq') WHERE change_seq IS NULL;
+
+CREATE INDEX IF NOT EXISTS task_change_seq_idx ON task (change_seq);
+
+CREATE OR REPLACE FUNCTION task_track_change() RETURNS trigger AS $$
+DECLARE
+    field text;
+BEGIN
+    -- Writers are serialized until commit so that sequence numbers become visible in order:
+    -- once a reader has seen change N, no change below N can still show up.
+    PERFORM pg_advisory_xact_lock(hashtext('task_change_seq'));
+    NEW.change_seq := nextval('task_change_seq');
+
+    FOREACH field IN ARRAY ARRAY['title', 'description', 'status', 'priority', 'due_date', 'estimate_minutes', 'position', 'deleted_at'] LOOP
+        IF TG_OP = 'INSERT' OR to_jsonb(NEW) -> field IS DISTINCT FROM to_jsonb(OLD) -> field THEN
+            NEW.field_seq := jsonb_set(NEW.field_seq, ARRAY[field], to_jsonb(NEW.change_seq));
+        END IF;
+    END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_track_change ON task;
+CREATE TRIGGER task_track_change BEFORE INSERT OR UPDATE ON task
+    FOR EACH ROW EXECUTE FUNCTION task_track_change();
+
+-- Assigning or unassigning changes who sees a task, so it counts as a change of the task
+CREATE OR REPLACE FUNCTION task_assignee_touch_task() RETURNS trigger AS $$
+BEGIN
+    UPDATE task SET change_seq = change_seq WHERE id = COALESCE(NEW.task_id, OLD.task_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_assignee_touch_task ON task_assignee;
+CREATE TRIGGER task_assignee_touch_task AFTER INSERT OR DELETE ON task_assignee
+    FOR EACH ROW EXECUTE FUNCTION task_assignee_touch_task();
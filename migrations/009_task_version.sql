@@ -0,0 +1,25 @@
+-- Optimistic concurrency: every write to a task, or to what its representation includes, bumps its version.
+ALTER TABLE task ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION task_bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_bump_version ON task;
+CREATE TRIGGER task_bump_version BEFORE UPDATE ON task
+    FOR EACH ROW EXECUTE FUNCTION task_bump_version();
+
+-- The comment count is part of a task, adding or removing a comment is a new version
+CREATE OR REPLACE FUNCTION comment_touch_task() RETURNS trigger AS $$
+BEGIN
+    UPDATE task SET version = version WHERE id = COALESCE(NEW.task_id, OLD.task_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comment_touch_task ON comment;
+CREATE TRIGGER comment_touch_task AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON comment
+    FOR EACH ROW EXECUTE FUNCTION comment_touch_task();
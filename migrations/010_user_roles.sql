@@ -0,0 +1,4 @@
+-- Roles and account state. Promote the first admin by hand:
+--   UPDATE "user" SET role = 'admin' WHERE username = '...';
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS role varchar NOT NULL DEFAULT 'user';
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS disabled_at timestamp;
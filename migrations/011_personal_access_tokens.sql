@@ -0,0 +1,13 @@
+-- Personal access tokens for scripts and CI, only the SHA-256 of the token is stored.
+CREATE TABLE IF NOT EXISTS personal_access_token (
+    id           serial PRIMARY KEY,
+    username     varchar NOT NULL,
+    name         varchar NOT NULL,
+    token_hash   varchar NOT NULL UNIQUE,
+    scopes       varchar[] NOT NULL,
+    expires_at   timestamp,
+    last_used_at timestamp,
+    created_at   timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_token_username_idx ON personal_access_token (username);
@@ -0,0 +1,13 @@
+-- Audit trail of security relevant events. actor is empty for anonymous events such as lockouts.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id         serial PRIMARY KEY,
+    actor      varchar,
+    action     varchar NOT NULL,
+    target     varchar,
+    ip         varchar,
+    details    jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target);
@@ -0,0 +1,15 @@
+-- TOTP two-factor authentication. The secret is encrypted with MFA_ENCRYPTION_KEY and only
+-- active once totp_enabled_at is set, totp_last_step stops a code from being used twice.
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS totp_secret varchar;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS totp_enabled_at timestamp;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS totp_last_step bigint;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_code (
+    id         serial PRIMARY KEY,
+    username   varchar NOT NULL,
+    code_hash  varchar NOT NULL,
+    used_at    timestamp,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_code_username_idx ON mfa_recovery_code (username);
@@ -0,0 +1,18 @@
+-- Optional email address for account recovery, only used once verified
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email varchar;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS email_verified_at timestamp;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_idx ON "user" (lower(email)) WHERE email IS NOT NULL;
+
+-- Single use tokens sent by email, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS user_token (
+    id         serial PRIMARY KEY,
+    username   varchar NOT NULL,
+    purpose    varchar NOT NULL,
+    token_hash varchar NOT NULL UNIQUE,
+    expires_at timestamp NOT NULL,
+    used_at    timestamp,
+    created_at timestamp NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_token_username_idx ON user_token (username, purpose);
@@ -0,0 +1,12 @@
+-- Identities at external OpenID Connect providers signing in to an account
+CREATE TABLE IF NOT EXISTS user_identity (
+    id         serial PRIMARY KEY,
+    username   varchar NOT NULL,
+    issuer     varchar NOT NULL,
+    subject    varchar NOT NULL,
+    email      varchar,
+    created_at timestamp NOT NULL DEFAULT now(),
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identity_username_idx ON user_identity (username);
@@ -0,0 +1,8 @@
+-- Profile fields and soft deletion of accounts. Tokens issued before sessions_valid_after
+-- are rejected, which logs out every session after a password change.
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS display_name varchar;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS time_zone varchar;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS locale varchar;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS avatar_url varchar;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS sessions_valid_after timestamp;
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS deleted_at timestamp;
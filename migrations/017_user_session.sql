@@ -0,0 +1,15 @@
+-- One row per login, the JWT carries token_id as its sid claim
+CREATE TABLE IF NOT EXISTS user_session (
+    id           serial PRIMARY KEY,
+    username     varchar NOT NULL,
+    token_id     varchar NOT NULL UNIQUE,
+    device       varchar,
+    user_agent   varchar,
+    ip           varchar,
+    created_at   timestamp NOT NULL DEFAULT now(),
+    last_seen_at timestamp NOT NULL DEFAULT now(),
+    expires_at   timestamp NOT NULL,
+    revoked_at   timestamp
+);
+
+CREATE INDEX IF NOT EXISTS user_session_username_idx ON user_session (username);
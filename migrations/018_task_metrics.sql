@@ -0,0 +1,2 @@
+-- Lets the task metrics count live tasks by status and overdue ones from the index alone
+CREATE INDEX IF NOT EXISTS task_status_due_date_idx ON task (status, due_date) WHERE deleted_at IS NULL;
@@ -0,0 +1,24 @@
+-- Delta sync: users who lose access to a task, by being unassigned, get it as a deletion.
+-- change_seq is the change of the task that removed their access.
+CREATE TABLE IF NOT EXISTS task_access_revoked (
+    task_id    integer NOT NULL REFERENCES task (id) ON DELETE CASCADE,
+    username   varchar NOT NULL,
+    change_seq bigint NOT NULL,
+    PRIMARY KEY (task_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS task_access_revoked_username_idx ON task_access_revoked (username, change_seq);
+
+CREATE OR REPLACE FUNCTION task_assignee_touch_task() RETURNS trigger AS $$
+BEGIN
+    UPDATE task SET change_seq = change_seq WHERE id = COALESCE(NEW.task_id, OLD.task_id);
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO task_access_revoked (task_id, username, change_seq)
+            SELECT id, OLD.username, change_seq FROM task WHERE id = OLD.task_id
+            ON CONFLICT (task_id, username) DO UPDATE SET change_seq = EXCLUDED.change_seq;
+    ELSE
+        DELETE FROM task_access_revoked WHERE task_id = NEW.task_id AND username = NEW.username;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
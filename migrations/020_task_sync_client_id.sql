@@ -0,0 +1,6 @@
+-- Delta sync: the id a client gave a task it created offline, so that a retried batch
+-- finds the task instead of creating it again
+ALTER TABLE task ADD COLUMN IF NOT EXISTS sync_client_id varchar;
+
+CREATE UNIQUE INDEX IF NOT EXISTS task_sync_client_id_idx ON task (created_by, sync_client_id)
+    WHERE sync_client_id IS NOT NULL;
@@ -0,0 +1,18 @@
+-- Tasks created before manual ordering have no position, so they could neither be moved
+-- nor used as neighbors. They go to the bottom of their column, oldest first: each gets the
+-- last position of the column followed by a fixed width counter, ending in 1 as rank keys
+-- must not end in 0.
+WITH numbered AS (
+    SELECT id, COALESCE(status, 'pending') AS column_status,
+           ROW_NUMBER() OVER (PARTITION BY COALESCE(status, 'pending') ORDER BY id) AS n
+    FROM task
+    WHERE position IS NULL
+), tails AS (
+    SELECT COALESCE(status, 'pending') AS column_status, MAX(position COLLATE "C") AS last
+    FROM task
+    WHERE position IS NOT NULL
+    GROUP BY 1
+)
+UPDATE task SET position = COALESCE(tails.last, 'V') || lpad(numbered.n::text, 9, '0') || '1'
+FROM numbered LEFT JOIN tails USING (column_status)
+WHERE task.id = numbered.id;
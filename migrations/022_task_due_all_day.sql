@@ -0,0 +1,24 @@
+-- Due dates without a time of day, shown as whole days by calendar clients. A due date at
+-- midnight used to be taken for a whole day, existing tasks keep being shown that way.
+ALTER TABLE task ADD COLUMN IF NOT EXISTS due_all_day boolean NOT NULL DEFAULT false;
+
+-- The flag is synced like the due date
+CREATE OR REPLACE FUNCTION task_track_change() RETURNS trigger AS $$
+DECLARE
+    field text;
+BEGIN
+    -- Writers are serialized until commit so that sequence numbers become visible in order:
+    -- once a reader has seen change N, no change below N can still show up.
+    PERFORM pg_advisory_xact_lock(hashtext('task_change_seq'));
+    NEW.change_seq := nextval('task_change_seq');
+
+    FOREACH field IN ARRAY ARRAY['title', 'description', 'status', 'priority', 'due_date', 'due_all_day', 'estimate_minutes', 'position', 'deleted_at'] LOOP
+        IF TG_OP = 'INSERT' OR to_jsonb(NEW) -> field IS DISTINCT FROM to_jsonb(OLD) -> field THEN
+            NEW.field_seq := jsonb_set(NEW.field_seq, ARRAY[field], to_jsonb(NEW.change_seq));
+        END IF;
+    END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE task SET due_all_day = true WHERE due_date IS NOT NULL AND due_date::time = '00:00';
@@ -0,0 +1,28 @@
+-- Delta sync: purged tasks leave a tombstone so that clients still learn they are gone.
+-- It records who could see the task, its creator and the users it was or had been assigned to,
+-- since their rows in task_assignee and task_access_revoked are deleted with it.
+CREATE TABLE IF NOT EXISTS task_purged (
+    task_id    integer PRIMARY KEY,
+    created_by varchar,
+    usernames  varchar[] NOT NULL,
+    change_seq bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS task_purged_change_seq_idx ON task_purged (change_seq);
+
+CREATE OR REPLACE FUNCTION task_record_purge() RETURNS trigger AS $$
+BEGIN
+    -- Numbered like any other change of the task, see task_track_change
+    PERFORM pg_advisory_xact_lock(hashtext('task_change_seq'));
+    INSERT INTO task_purged (task_id, created_by, usernames, change_seq)
+        VALUES (OLD.id, OLD.created_by, ARRAY(
+            SELECT username FROM task_assignee WHERE task_id = OLD.id
+            UNION SELECT username FROM task_access_revoked WHERE task_id = OLD.id), nextval('task_change_seq'))
+        ON CONFLICT (task_id) DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_record_purge ON task;
+CREATE TRIGGER task_record_purge BEFORE DELETE ON task
+    FOR EACH ROW EXECUTE FUNCTION task_record_purge();
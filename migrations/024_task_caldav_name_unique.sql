@@ -0,0 +1,11 @@
+-- CalDAV resource names are unique per user, so that two clients putting the same new
+-- resource at once create one task. Duplicates created before are renamed after their id,
+-- the oldest keeps the name.
+UPDATE task SET caldav_name = NULL
+    WHERE caldav_name IS NOT NULL AND deleted_at IS NULL AND EXISTS (
+        SELECT 1 FROM task older WHERE older.created_by = task.created_by AND older.caldav_name = task.caldav_name
+            AND older.deleted_at IS NULL AND older.id < task.id);
+
+DROP INDEX IF EXISTS task_caldav_name_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS task_caldav_name_idx ON task (created_by, caldav_name)
+    WHERE caldav_name IS NOT NULL AND deleted_at IS NULL;
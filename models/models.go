@@ -7,20 +7,96 @@ import (
 )
 
 type Task struct {
+	ID              int        `gorm:"primaryKey;autoIncrement;column:id"`
+	Title           *string    `gorm:"type:varchar;column:title"`
+	Description     *string    `gorm:"type:varchar;column:description"`
+	Status          *string    `gorm:"type:varchar;column:status;default:'pending'"`
+	Priority        *string    `gorm:"type:varchar;column:priority;default:'P2'"`
+	Position        *string    `gorm:"type:varchar;column:position"`
+	DueDate         *time.Time `gorm:"column:due_date"`
+	DueAllDay       bool       `gorm:"column:due_all_day"`
+	EstimateMinutes *int       `gorm:"column:estimate_minutes"`
+	CreatedAt       *time.Time `gorm:"column:created_at"`
+	CreatedBy       *string    `gorm:"type:varchar;column:created_by"`
+	UpdatedAt       *time.Time `gorm:"column:updated_at"`
+	UpdatedBy       *string    `gorm:"type:varchar;column:updated_by"`
+	DeletedAt       *time.Time `gorm:"column:deleted_at"`
+	Version         int        `gorm:"column:version;default:1"`
+
+	Assignees       []string `gorm:"-"`
+	DescriptionHTML *string  `gorm:"-"`
+	CommentCount    int      `gorm:"-"`
+	ETag            string   `gorm:"-"`
+}
+
+type User struct {
+	ID         int        `gorm:"primaryKey;autoIncrement;column:id"`
+	Username   *string    `gorm:"type:varchar;column:username"`
+	Password   *string    `gorm:"type:varchar;column:password"` // to do hashed
+	Role       *string    `gorm:"type:varchar;column:role;default:'user'"`
+	DisabledAt *time.Time `gorm:"column:disabled_at"`
+
+	Email           *string    `gorm:"type:varchar;column:email"`
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"-"`
+
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+
+	DisplayName        *string    `gorm:"type:varchar;column:display_name"`
+	TimeZone           *string    `gorm:"type:varchar;column:time_zone"`
+	Locale             *string    `gorm:"type:varchar;column:locale"`
+	AvatarURL          *string    `gorm:"type:varchar;column:avatar_url"`
+	SessionsValidAfter *time.Time `gorm:"column:sessions_valid_after" json:"-"`
+	DeletedAt          *time.Time `gorm:"column:deleted_at" json:"-"`
+
+	CalendarTokenHash *string `gorm:"type:varchar;column:calendar_token_hash" json:"-"`
+}
+
+type Comment struct {
+	ID        int        `gorm:"primaryKey;autoIncrement;column:id"`
+	TaskID    int        `gorm:"column:task_id"`
+	ParentID  *int       `gorm:"column:parent_id"`
+	Author    *string    `gorm:"type:varchar;column:author"`
+	Body      *string    `gorm:"type:varchar;column:body"`
+	CreatedAt *time.Time `gorm:"column:created_at"`
+	UpdatedAt *time.Time `gorm:"column:updated_at"`
+	DeletedAt *time.Time `gorm:"column:deleted_at"`
+
+	BodyHTML *string    `gorm:"-"`
+	Replies  []*Comment `gorm:"-"`
+}
+
+type Attachment struct {
 	ID          int        `gorm:"primaryKey;autoIncrement;column:id"`
-	Title       *string    `gorm:"type:varchar;column:title"`
-	Description *string    `gorm:"type:varchar;column:description"`
-	Status      *string    `gorm:"type:varchar;column:status;default:'pending'"`
-	DueDate     *time.Time `gorm:"column:due_date"`
+	TaskID      int        `gorm:"column:task_id"`
+	Filename    *string    `gorm:"type:varchar;column:filename"`
+	ContentType *string    `gorm:"type:varchar;column:content_type"`
+	Size        int64      `gorm:"column:size"`
+	SHA256      *string    `gorm:"type:varchar;column:sha256"`
+	UploadedBy  *string    `gorm:"type:varchar;column:uploaded_by"`
 	CreatedAt   *time.Time `gorm:"column:created_at"`
-	CreatedBy   *string    `gorm:"type:varchar;column:created_by"`
-	UpdatedAt   *time.Time `gorm:"column:updated_at"`
-	UpdatedBy   *string    `gorm:"type:varchar;column:updated_by"`
-	DeletedAt   *time.Time `gorm:"column:deleted_at"`
+
+	DownloadURL *string `gorm:"-"`
 }
 
-type User struct {
-	ID       int     `gorm:"primaryKey;autoIncrement;column:id"`
-	Username *string `gorm:"type:varchar;column:username"`
-	Password *string `gorm:"type:varchar;column:password"` // to do hashed
+type TimeEntry struct {
+	ID        int        `gorm:"primaryKey;autoIncrement;column:id"`
+	TaskID    int        `gorm:"column:task_id"`
+	Username  *string    `gorm:"type:varchar;column:username"`
+	StartedAt *time.Time `gorm:"column:started_at"`
+	EndedAt   *time.Time `gorm:"column:ended_at"`
+	Note      *string    `gorm:"type:varchar;column:note"`
+	Source    *string    `gorm:"type:varchar;column:source;default:'timer'"`
+	CreatedAt *time.Time `gorm:"column:created_at"`
+
+	Minutes *float64 `gorm:"-"`
+}
+
+type Notification struct {
+	ID        int        `gorm:"primaryKey;autoIncrement;column:id"`
+	Username  *string    `gorm:"type:varchar;column:username"`
+	Type      *string    `gorm:"type:varchar;column:type"`
+	TaskID    *int       `gorm:"column:task_id"`
+	Message   *string    `gorm:"type:varchar;column:message"`
+	CreatedAt *time.Time `gorm:"column:created_at"`
+	ReadAt    *time.Time `gorm:"column:read_at"`
 }
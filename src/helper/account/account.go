@@ -0,0 +1,111 @@
+package account
+
+import (
+	database "be-golang-todo/src/helper/db"
+	config "be-golang-todo/src/helper/redis"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// cacheTTL bounds how long a change made outside of Invalidate, by hand in the database, takes to apply
+const cacheTTL = time.Minute
+
+var ErrNotFound = errors.New("account not found")
+
+// Account is the state of a user that authorization depends on
+type Account struct {
+	Username string
+	Role     string
+	Disabled bool
+	// SessionsValidAfter is when the password last changed, older JWTs are no longer accepted
+	SessionsValidAfter *time.Time
+}
+
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// Get returns the state of an account, cached in Redis so that it can be checked on every request
+func Get(ctx context.Context, username string) (Account, error) {
+	key := cacheKey(username)
+	if cached, err := config.RDB.Get(ctx, key).Bytes(); err == nil {
+		var a Account
+		if err := json.Unmarshal(cached, &a); err == nil {
+			if a.Username == "" {
+				return a, ErrNotFound
+			}
+			return a, nil
+		}
+	}
+
+	var a Account
+	err := database.DB.QueryRowContext(ctx, "SELECT username, role, disabled_at IS NOT NULL, sessions_valid_after FROM \"user\" WHERE username = $1", username).Scan(
+		&a.Username, &a.Role, &a.Disabled, &a.SessionsValidAfter)
+	if err != nil && err != sql.ErrNoRows {
+		return a, err
+	}
+
+	// Unknown users are cached too, a deleted account must not cost a query per request
+	data, _ := json.Marshal(a)
+	config.RDB.Set(ctx, key, data, cacheTTL)
+
+	if err == sql.ErrNoRows {
+		return a, ErrNotFound
+	}
+	return a, nil
+}
+
+// Invalidate must be called after changing the role, state or password of an account, or deleting it
+func Invalidate(ctx context.Context, username string) error {
+	// The change is committed already, the cache must follow even when the client hung up
+	return config.RDB.Del(context.WithoutCancel(ctx), cacheKey(username)).Err()
+}
+
+// EndSessions makes every JWT issued so far invalid. Tokens issued from now on, in the
+// same second included, are accepted.
+// Invalidate has to be called once the change is committed.
+func EndSessions(ctx context.Context, db execer, username string) error {
+	_, err := db.ExecContext(ctx, "UPDATE \"user\" SET sessions_valid_after = $1 WHERE username = $2", time.Now().Truncate(time.Second), username)
+	return err
+}
+
+// Tombstone deletes what belongs to the account alone and blanks its credentials. The row
+// stays, deleted, so that the username remains reserved: tasks, comments, time entries and
+// the audit trail refer to users by name and must not pass to whoever registers it next.
+// Invalidate and session.RevokeAll have to be called once the change is committed.
+func Tombstone(ctx context.Context, db execer, username string) error {
+	for _, query := range []string{
+		"DELETE FROM task_assignee WHERE username = $1",
+		"DELETE FROM notification WHERE username = $1",
+		"DELETE FROM personal_access_token WHERE username = $1",
+		"DELETE FROM mfa_recovery_code WHERE username = $1",
+		"DELETE FROM user_token WHERE username = $1",
+		"DELETE FROM user_identity WHERE username = $1",
+	} {
+		if _, err := db.ExecContext(ctx, query, username); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `UPDATE "user" SET deleted_at = $1, disabled_at = COALESCE(disabled_at, $1), password = '',
+		email = NULL, email_verified_at = NULL, totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL,
+		calendar_token_hash = NULL, sessions_valid_after = $1 WHERE username = $2`, now, username)
+	return err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func cacheKey(username string) string {
+	return "account:" + username
+}
@@ -0,0 +1,85 @@
+package account
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TokenPrefix starts every personal access token, telling them apart from JWTs
+const TokenPrefix = "pat_"
+
+// Scopes a personal access token can be granted. A write scope includes the matching read scope.
+const (
+	ScopeTasksRead          = "tasks:read"
+	ScopeTasksWrite         = "tasks:write"
+	ScopeTimeRead           = "time:read"
+	ScopeTimeWrite          = "time:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+	ScopeAdminRead          = "admin:read"
+	ScopeAdminWrite         = "admin:write"
+)
+
+var Scopes = []string{ScopeTasksRead, ScopeTasksWrite, ScopeTimeRead, ScopeTimeWrite,
+	ScopeNotificationsRead, ScopeNotificationsWrite, ScopeAdminRead, ScopeAdminWrite}
+
+// lastUsedResolution limits the writes made to record when a token was last used
+const lastUsedResolution = time.Minute
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the granted scopes allow the required one
+func HasScope(granted []string, required string) bool {
+	resource, access, _ := strings.Cut(required, ":")
+	for _, scope := range granted {
+		if scope == required || (access == "read" && scope == resource+":write") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewToken returns a new personal access token and the hash to store
+func NewToken() (string, string, error) {
+	random, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := TokenPrefix + random
+	return token, utils.HashToken(token), nil
+}
+
+// AuthenticateToken returns the owner and scopes of a live personal access token and records its use
+func AuthenticateToken(ctx context.Context, token string) (string, []string, error) {
+	var id int
+	var username string
+	var scopes []string
+	err := database.DB.QueryRowContext(ctx, `SELECT id, username, scopes FROM personal_access_token
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > now())`, utils.HashToken(token)).Scan(
+		&id, &username, pq.Array(&scopes))
+	if err == sql.ErrNoRows {
+		return "", nil, ErrInvalidToken
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	_, err = database.DB.ExecContext(ctx, `UPDATE personal_access_token SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`, time.Now(), id, time.Now().Add(-lastUsedResolution))
+	return username, scopes, err
+}
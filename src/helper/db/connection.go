@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 
+	"github.com/XSAM/otelsql"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 var DB *sql.DB
@@ -28,7 +30,8 @@ func Init() {
 		os.Getenv("POSTGRES_PORT"),
 	)
 
-	DB, err = sql.Open("postgres", connStr)
+	// Every statement gets a span, a child of the request span when it is given the request context
+	DB, err = otelsql.Open("postgres", connStr, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 
 	if err != nil {
 		log.Fatal("Failed to connect to PostgreSQL:", err)
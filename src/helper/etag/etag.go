@@ -0,0 +1,94 @@
+package etag
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Format formats a version as a strong entity tag
+func Format(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// IfMatch is a parsed If-Match header. Any is set for "*", Versions holds the versions
+// of the strong entity tags, weak ones never match.
+type IfMatch struct {
+	Present  bool
+	Any      bool
+	Versions []int
+}
+
+// ParseIfMatch reads the If-Match header of a request, Present is false without one
+func ParseIfMatch(r *http.Request) IfMatch {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	m := IfMatch{Present: header != ""}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			m.Any = true
+			continue
+		}
+		if version, ok := parse(tag); ok {
+			m.Versions = append(m.Versions, version)
+		}
+	}
+	return m
+}
+
+// Matches reports whether a write to the given version may go ahead
+func (m IfMatch) Matches(version int) bool {
+	if !m.Present || m.Any {
+		return true
+	}
+	for _, v := range m.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Clause returns the condition that makes an UPDATE or DELETE only hit a matching version,
+// so that the check and the write cannot race. argID is the number of its placeholder.
+func (m IfMatch) Clause(argID int) (string, []interface{}) {
+	if !m.Present || m.Any {
+		return "", nil
+	}
+	// An empty list, when no tag could be parsed, never matches
+	versions := make([]int64, len(m.Versions))
+	for i, v := range m.Versions {
+		versions[i] = int64(v)
+	}
+	return fmt.Sprintf(" AND version = ANY($%d)", argID), []interface{}{pq.Array(versions)}
+}
+
+// NoneMatch reports whether the If-None-Match header of a request matches the given version,
+// using the weak comparison
+func NoneMatch(r *http.Request, version int) bool {
+	header := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" {
+			return true
+		}
+		if v, ok := parse(tag); ok && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func parse(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	return version, err == nil
+}
@@ -0,0 +1,300 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Minimal RFC 5545 support: enough to write task feeds and read VTODO/VEVENT entries
+
+const (
+	dateTimeUTCLayout = "20060102T150405Z"
+	dateTimeLayout    = "20060102T150405"
+	dateLayout        = "20060102"
+
+	// maxLineOctets is the longest content line allowed before folding
+	maxLineOctets = 75
+)
+
+var ErrInvalidCalendar = errors.New("invalid iCalendar data")
+
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+// Add appends a property with an already encoded value
+func (c *Component) Add(name string, value string) {
+	c.Properties = append(c.Properties, Property{Name: name, Value: value})
+}
+
+// AddText appends a property with a TEXT value, escaping it
+func (c *Component) AddText(name string, value string) {
+	c.Add(name, EscapeText(value))
+}
+
+// Get returns the first property with the given name, or nil
+func (c *Component) Get(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Text returns the unescaped value of a TEXT property, or "" when it is missing
+func (c *Component) Text(name string) string {
+	if p := c.Get(name); p != nil {
+		return UnescapeText(p.Value)
+	}
+	return ""
+}
+
+// Encode writes the component with CRLF line endings and folded long lines
+func Encode(w io.Writer, c *Component) error {
+	bw := bufio.NewWriter(w)
+	if err := encodeComponent(bw, c); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func encodeComponent(w *bufio.Writer, c *Component) error {
+	if err := writeLine(w, "BEGIN:"+c.Name); err != nil {
+		return err
+	}
+	for _, p := range c.Properties {
+		line := p.Name
+		// Sorted so that the output is stable
+		names := make([]string, 0, len(p.Params))
+		for name := range p.Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := p.Params[name]
+			if strings.ContainsAny(value, ";:,") {
+				value = `"` + value + `"`
+			}
+			line += ";" + name + "=" + value
+		}
+		if err := writeLine(w, line+":"+p.Value); err != nil {
+			return err
+		}
+	}
+	for _, child := range c.Components {
+		if err := encodeComponent(w, child); err != nil {
+			return err
+		}
+	}
+	return writeLine(w, "END:"+c.Name)
+}
+
+// writeLine folds lines longer than 75 octets without splitting UTF-8 sequences
+func writeLine(w *bufio.Writer, line string) error {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if _, err := w.WriteString(line[:cut] + "\r\n "); err != nil {
+			return err
+		}
+		line = line[cut:]
+		// Continuation lines start with a space that counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	_, err := w.WriteString(line + "\r\n")
+	return err
+}
+
+// Decode reads the first top level component, normally a VCALENDAR
+func Decode(r io.Reader) (*Component, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*Component
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch p.Name {
+		case "BEGIN":
+			child := NewComponent(strings.ToUpper(p.Value))
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, child)
+			}
+			stack = append(stack, child)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("%w: unexpected END:%s", ErrInvalidCalendar, p.Value)
+			}
+			if len(stack) == 1 {
+				return stack[0], nil
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: property outside of a component", ErrInvalidCalendar)
+			}
+			current := stack[len(stack)-1]
+			current.Properties = append(current.Properties, p)
+		}
+	}
+	return nil, fmt.Errorf("%w: unterminated component", ErrInvalidCalendar)
+}
+
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits "NAME;PARAM=VALUE:value" honoring quoted parameter values
+func parseLine(line string) (Property, error) {
+	p := Property{Params: map[string]string{}}
+
+	inQuotes := false
+	nameEnd, valueStart := -1, -1
+	for i := 0; i < len(line) && valueStart < 0; i++ {
+		switch line[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case ';':
+			if !inQuotes && nameEnd < 0 {
+				nameEnd = i
+			}
+		case ':':
+			if !inQuotes {
+				valueStart = i + 1
+				if nameEnd < 0 {
+					nameEnd = i
+				}
+			}
+		}
+	}
+	if valueStart < 0 {
+		return p, fmt.Errorf("%w: malformed line %q", ErrInvalidCalendar, line)
+	}
+
+	p.Name = strings.ToUpper(line[:nameEnd])
+	p.Value = line[valueStart:]
+	if params := line[nameEnd : valueStart-1]; params != "" {
+		for _, param := range splitParams(strings.TrimPrefix(params, ";")) {
+			name, value, _ := strings.Cut(param, "=")
+			p.Params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return p, nil
+}
+
+func splitParams(params string) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case ';':
+			if !inQuotes {
+				parts = append(parts, params[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, params[start:])
+}
+
+// EscapeText escapes a TEXT value
+func EscapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// UnescapeText reverses EscapeText
+func UnescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// FormatUTC formats a DATE-TIME in UTC ("Z" form)
+func FormatUTC(t time.Time) string {
+	return t.UTC().Format(dateTimeUTCLayout)
+}
+
+// FormatDate formats a DATE value
+func FormatDate(t time.Time) string {
+	return t.Format(dateLayout)
+}
+
+// ParseTime reads a DATE or DATE-TIME property. UTC values and values with a TZID
+// are converted to UTC, floating times are taken as UTC. dateOnly reports a DATE value.
+func ParseTime(p *Property) (t time.Time, dateOnly bool, err error) {
+	if p.Params["VALUE"] == "DATE" || len(p.Value) == len(dateLayout) {
+		t, err = time.Parse(dateLayout, p.Value)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(p.Value, "Z") {
+		t, err = time.Parse(dateTimeUTCLayout, p.Value)
+		return t, false, err
+	}
+
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if loc, err = time.LoadLocation(strings.TrimPrefix(tzid, "/")); err != nil {
+			return t, false, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+	t, err = time.ParseInLocation(dateTimeLayout, p.Value, loc)
+	return t.UTC(), false, err
+}
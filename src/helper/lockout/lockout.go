@@ -0,0 +1,136 @@
+package lockout
+
+import (
+	"be-golang-todo/src/helper/password"
+	config "be-golang-todo/src/helper/redis"
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// failureWindow is how long a failed attempt counts
+	failureWindow = 15 * time.Minute
+
+	// Failures after which a username or an address is locked out. An address gets more
+	// since many users can share one.
+	maxUserFailures = 5
+	maxIPFailures   = 20
+
+	lockoutDuration = 15 * time.Minute
+
+	// Delays applied before checking a password, doubling with every failure
+	baseDelay = 250 * time.Millisecond
+	maxDelay  = 4 * time.Second
+)
+
+// Status is the state of the attempts of a username from an address
+type Status struct {
+	Failures int
+
+	// RetryAfter is set when the username or the address is locked out
+	RetryAfter time.Duration
+}
+
+// Delay is how long to wait before checking the next password
+func (s Status) Delay() time.Duration {
+	if s.Failures == 0 {
+		return 0
+	}
+	delay := baseDelay << (s.Failures - 1)
+	if delay > maxDelay || delay <= 0 {
+		return maxDelay
+	}
+	return delay
+}
+
+// Check returns the state of a login attempt. Redis errors are logged and let the attempt through.
+func Check(ctx context.Context, username string, ip string) Status {
+	var s Status
+	for _, key := range []string{lockKey("user", username), lockKey("ip", ip)} {
+		ttl, err := config.RDB.PTTL(ctx, key).Result()
+		if err != nil {
+			slog.Error("login lock check failed", "error", err)
+			continue
+		}
+		if ttl > s.RetryAfter {
+			s.RetryAfter = ttl
+		}
+	}
+
+	for _, key := range []string{failureKey("user", username), failureKey("ip", ip)} {
+		failures, err := config.RDB.Get(ctx, key).Int()
+		if err != nil {
+			continue
+		}
+		if failures > s.Failures {
+			s.Failures = failures
+		}
+	}
+	return s
+}
+
+// RecordFailure counts a failed attempt and reports whether it locked out the username or the address
+func RecordFailure(ctx context.Context, username string, ip string) (bool, error) {
+	// Hanging up must not spare a guess from being counted
+	ctx = context.WithoutCancel(ctx)
+	locked := false
+	for _, c := range []struct {
+		kind, value string
+		max         int
+	}{{"user", username, maxUserFailures}, {"ip", ip, maxIPFailures}} {
+		key := failureKey(c.kind, c.value)
+		failures, err := config.RDB.Incr(ctx, key).Result()
+		if err != nil {
+			return locked, err
+		}
+		if failures == 1 {
+			config.RDB.Expire(ctx, key, failureWindow)
+		}
+		if failures >= int64(c.max) {
+			if err := config.RDB.Set(ctx, lockKey(c.kind, c.value), failures, lockoutDuration).Err(); err != nil {
+				return locked, err
+			}
+			// The next lockout needs a full series of failures again
+			config.RDB.Del(ctx, key)
+			locked = true
+		}
+	}
+	return locked, nil
+}
+
+// Reset clears the failures of a username after a successful login. Failures of the
+// address are left to expire, otherwise logging into one account would reset the
+// count of an attacker guessing the passwords of others.
+func Reset(ctx context.Context, username string) error {
+	return config.RDB.Del(ctx, failureKey("user", username)).Err()
+}
+
+func failureKey(kind string, value string) string {
+	return "login:failures:" + kind + ":" + strings.ToLower(value)
+}
+
+func lockKey(kind string, value string) string {
+	return "login:locked:" + kind + ":" + strings.ToLower(value)
+}
+
+// VerifyPassword compares a password with a stored hash. An empty hash, for an unknown
+// user, goes through a dummy comparison so that the answer takes as long as for a real user.
+func VerifyPassword(hashedPassword string, plain string) bool {
+	if hashedPassword == "" {
+		password.VerifyDummy(plain)
+		return false
+	}
+	ok, err := password.Verify(hashedPassword, plain)
+	if err != nil {
+		slog.Error("password verification failed", "error", err)
+	}
+	return ok
+}
+
+// RetryAfterSeconds formats a lockout for the Retry-After header
+func RetryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+// Init makes the default logger write LOG_FORMAT ("json" or "text") lines to stdout,
+// dropping those below LOG_LEVEL ("debug", "info", "warn" or "error")
+func Init() {
+	// The file is optional here, the other Init functions insist on it
+	_ = godotenv.Load()
+
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			log.Fatal("Invalid LOG_LEVEL: ", value)
+		}
+	}
+	logger, err := New(os.Stdout, os.Getenv("LOG_FORMAT"), level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+}
+
+// New returns a logger writing lines of the given format, "json" when empty
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	// Lines point at the code that logged them, as handler error messages are generic
+	options := &slog.HandlerOptions{Level: level, AddSource: true}
+	switch strings.ToLower(format) {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// scope holds the logger of one request, which gains fields as the request is handled
+type scope struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+}
+
+type scopeKey struct{}
+
+// NewContext returns a context carrying a request scoped logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{logger: logger})
+}
+
+// FromContext returns the logger of the request, or the default logger outside of one
+func FromContext(ctx context.Context) *slog.Logger {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.logger
+	}
+	return slog.Default()
+}
+
+// From returns the logger of the request
+func From(r *http.Request) *slog.Logger {
+	return FromContext(r.Context())
+}
+
+// With adds fields to every later line logged for the request, including its access line
+func With(r *http.Request, args ...any) {
+	if s, ok := r.Context().Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.logger = s.logger.With(args...)
+	}
+}
@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// LogMailer writes messages to the log instead of delivering them, for development
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if !validHeader(msg.To) || !validHeader(msg.Subject) {
+		return fmt.Errorf("invalid recipient or subject")
+	}
+	slog.Info("mail", "to", msg.To, "message", string(Format(m.from, msg, time.Now())))
+	return nil
+}
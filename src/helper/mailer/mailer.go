@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"mime"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var Default Mailer
+
+// Init configures the mailer from MAIL_BACKEND ("log", "file" or "smtp")
+func Init() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading env file")
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch os.Getenv("MAIL_BACKEND") {
+	case "", "log":
+		Default = NewLogMailer(from)
+	case "file":
+		dir := os.Getenv("MAIL_FILE_DIR")
+		if dir == "" {
+			dir = "data/mail"
+		}
+		Default, err = NewFileMailer(dir, from)
+	case "smtp":
+		Default = NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	default:
+		log.Fatal("Unknown MAIL_BACKEND: ", os.Getenv("MAIL_BACKEND"))
+	}
+
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+}
+
+// Send delivers a message with the configured mailer
+func Send(ctx context.Context, msg Message) error {
+	if Default == nil {
+		return fmt.Errorf("mailer is not initialized")
+	}
+	return Default.Send(ctx, msg)
+}
+
+// SendInBackground delivers a message without holding up the request, failures are logged.
+// It also keeps the response time from telling whether a message was sent.
+func SendInBackground(msg Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := Send(ctx, msg); err != nil {
+			slog.Error("mail not sent", "to", msg.To, "error", err)
+		}
+	}()
+}
+
+// Format renders a message in RFC 5322 format with CRLF line endings
+func Format(from string, msg Message, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// validHeader rejects values that could inject further headers
+func validHeader(value string) bool {
+	return value != "" && !strings.ContainsAny(value, "\r\n")
+}
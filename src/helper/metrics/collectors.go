@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	database "be-golang-todo/src/helper/db"
+	config "be-golang-todo/src/helper/redis"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	redisHits = prometheus.NewDesc("redis_pool_hits_total",
+		"Times a free connection was found in the Redis pool.", nil, nil)
+	redisMisses = prometheus.NewDesc("redis_pool_misses_total",
+		"Times no free connection was found in the Redis pool.", nil, nil)
+	redisTimeouts = prometheus.NewDesc("redis_pool_timeouts_total",
+		"Times waiting for a Redis connection timed out.", nil, nil)
+	redisStale = prometheus.NewDesc("redis_pool_stale_connections_total",
+		"Stale connections removed from the Redis pool.", nil, nil)
+	redisConns = prometheus.NewDesc("redis_pool_connections",
+		"Connections in the Redis pool.", nil, nil)
+	redisIdle = prometheus.NewDesc("redis_pool_idle_connections",
+		"Idle connections in the Redis pool.", nil, nil)
+)
+
+// redisCollector reads the pool statistics of the Redis client at scrape time
+type redisCollector struct{}
+
+func (redisCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{redisHits, redisMisses, redisTimeouts, redisStale, redisConns, redisIdle} {
+		ch <- desc
+	}
+}
+
+func (redisCollector) Collect(ch chan<- prometheus.Metric) {
+	if config.RDB == nil {
+		return
+	}
+	stats := config.RDB.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(redisMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(redisTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisStale, prometheus.CounterValue, float64(stats.StaleConns))
+	ch <- prometheus.MustNewConstMetric(redisConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(redisIdle, prometheus.GaugeValue, float64(stats.IdleConns))
+}
+
+var (
+	tasksDesc = prometheus.NewDesc("tasks",
+		"Tasks that are not deleted, by status.", []string{"status"}, nil)
+	overdueDesc = prometheus.NewDesc("tasks_overdue",
+		"Tasks past their due date that are not done.", nil, nil)
+)
+
+// taskCollector reports task counts from a single aggregate query, run at most once per
+// ttl however often the metrics are scraped
+type taskCollector struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	byStatus map[string]int
+	overdue  int
+}
+
+func newTaskCollector(ttl time.Duration) *taskCollector {
+	return &taskCollector{ttl: ttl}
+}
+
+func (c *taskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tasksDesc
+	ch <- overdueDesc
+}
+
+func (c *taskCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.loadedAt) > c.ttl {
+		byStatus, overdue, err := countTasks()
+		if err != nil {
+			// The previous counts, if any, are served until the query works again
+			slog.Error("task metrics not refreshed", "error", err)
+		} else {
+			c.byStatus, c.overdue, c.loadedAt = byStatus, overdue, time.Now()
+		}
+	}
+	if c.byStatus == nil {
+		return
+	}
+	for status, count := range c.byStatus {
+		ch <- prometheus.MustNewConstMetric(tasksDesc, prometheus.GaugeValue, float64(count), status)
+	}
+	ch <- prometheus.MustNewConstMetric(overdueDesc, prometheus.GaugeValue, float64(c.overdue))
+}
+
+func countTasks() (map[string]int, int, error) {
+	rows, err := database.DB.Query(`SELECT COALESCE(status, 'pending'), COUNT(*),
+		COUNT(*) FILTER (WHERE due_date < now() AND status IS DISTINCT FROM 'done')
+		FROM task WHERE deleted_at IS NULL GROUP BY 1`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	byStatus := make(map[string]int)
+	var overdue int
+	for rows.Next() {
+		var status string
+		var count, late int
+		if err := rows.Scan(&status, &count, &late); err != nil {
+			return nil, 0, err
+		}
+		byStatus[status] = count
+		overdue += late
+	}
+	return byStatus, overdue, rows.Err()
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route pattern and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to answer HTTP requests by method, route pattern and status.",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_lookups_total",
+		Help: "Cache lookups by cache and result, hit or miss.",
+	}, []string{"cache", "result"})
+)
+
+// knownMethods keeps a client sending made up methods to unknown paths from adding label values
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+func init() {
+	Registry.MustRegister(httpRequests, httpDuration, cacheLookups)
+}
+
+// Init adds the collectors reading the runtime, the PostgreSQL and Redis pools and the
+// task counts, which need the clients to be set up first
+func Init() {
+	ttl := time.Minute
+	if value := os.Getenv("METRICS_TASK_STATS_TTL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatal("Invalid METRICS_TASK_STATS_TTL: ", value)
+		}
+		ttl = d
+	}
+
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(database.DB, "postgres"),
+		redisCollector{},
+		newTaskCollector(ttl),
+	)
+}
+
+// ObserveRequest counts an answered request. Requests matching no route share the
+// "unmatched" route so that scanning random paths does not grow the label set.
+func ObserveRequest(method string, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+	}
+	labels := prometheus.Labels{"method": method, "route": route, "status": strconv.Itoa(status)}
+	httpRequests.With(labels).Inc()
+	httpDuration.With(labels).Observe(elapsed.Seconds())
+}
+
+// CacheLookup counts a hit or a miss of the named cache
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Handler serves the metrics in the Prometheus text format. With METRICS_TOKEN set, the
+// scraper has to send it as a bearer token.
+func Handler() http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	token := os.Getenv("METRICS_TOKEN")
+	if token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized: missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,134 @@
+package password
+
+import (
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// embeddedBreached is a short list of the most common passwords, used when
+// BREACHED_PASSWORDS_FILE does not point to a complete download
+//
+//go:embed breached.txt
+var embeddedBreached []byte
+
+// maxLineLength bounds a "HASH:COUNT" line, the 40 hex digits of SHA-1 and a count
+const maxLineLength = 64
+
+// BreachedList looks up passwords in a file of SHA-1 hashes sorted by hash, one "HASH" or
+// "HASH:COUNT" per line, the format of the ordered Pwned Passwords download. Like the range
+// API it locates the five character prefix of the hash and only compares within that range,
+// the file is searched in place and never loaded in memory.
+type BreachedList struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// OpenBreachedList opens a list file, it stays open for the life of the process
+func OpenBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &BreachedList{r: f, size: info.Size()}, nil
+}
+
+// EmbeddedBreachedList returns the list shipped with the binary
+func EmbeddedBreachedList() *BreachedList {
+	return NewBreachedList(embeddedBreached)
+}
+
+// NewBreachedList reads a list held in memory
+func NewBreachedList(data []byte) *BreachedList {
+	return &BreachedList{r: bytes.NewReader(data), size: int64(len(data))}
+}
+
+// Contains tells whether the password appears in the list
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix := hash[:5]
+
+	// Find the smallest offset whose next line is at or after the prefix, the line found
+	// there is the first one of the range
+	lo, hi := int64(0), l.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, _, err := l.lineAfter(mid)
+		if err != nil {
+			return false, err
+		}
+		if line == "" || line[:min(5, len(line))] >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	_, start, err := l.lineAfter(lo)
+	if err != nil {
+		return false, err
+	}
+	for start < l.size {
+		line, err := l.lineAt(start)
+		if err != nil {
+			return false, err
+		}
+		if !strings.HasPrefix(line, prefix) {
+			return false, nil
+		}
+		if h, _, _ := strings.Cut(strings.TrimSuffix(line, "\r"), ":"); h == hash {
+			return true, nil
+		}
+		start += int64(len(line)) + 1
+	}
+	return false, nil
+}
+
+// lineAfter returns the first line starting at or after offset and where it starts,
+// "" at the end of the file
+func (l *BreachedList) lineAfter(offset int64) (string, int64, error) {
+	start := offset
+	if offset > 0 {
+		// A line starts at offset when the byte before it ends the previous line
+		buf := make([]byte, maxLineLength+1)
+		n, err := l.r.ReadAt(buf, offset-1)
+		if err != nil && err != io.EOF {
+			return "", 0, err
+		}
+		i := bytes.IndexByte(buf[:n], '\n')
+		if i < 0 {
+			return "", l.size, nil
+		}
+		start = offset + int64(i)
+	}
+	if start >= l.size {
+		return "", l.size, nil
+	}
+	line, err := l.lineAt(start)
+	return line, start, err
+}
+
+// lineAt reads the line starting at offset, upper cased and without its line ending.
+// The returned length, plus one for the newline, leads to the next line.
+func (l *BreachedList) lineAt(offset int64) (string, error) {
+	buf := make([]byte, maxLineLength)
+	n, err := l.r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	return strings.ToUpper(string(buf)), nil
+}
@@ -0,0 +1,200 @@
+package password
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// Rules a password can break, reported in Violation.Rule
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleSimilarUsername  = "similar_to_username"
+	RuleBreached         = "breached"
+	RuleStrength         = "strength"
+)
+
+// maxScoredLength bounds the input of the strength estimation, which grows quickly with length
+const maxScoredLength = 100
+
+// Policy is what a new password has to satisfy
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinClasses is how many of lower case letters, upper case letters, digits and symbols must be mixed
+	MinClasses int
+	// MinScore is the lowest zxcvbn score accepted, from 0 (too guessable) to 4 (very unguessable)
+	MinScore int
+	// RejectUsername refuses passwords containing the username or close to it
+	RejectUsername bool
+	// Breached lists known leaked passwords, nil skips the check
+	Breached *BreachedList
+}
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Default is the policy applied to every new password, set by Init
+var Default = Policy{
+	MinLength:      8,
+	MaxLength:      128,
+	MinScore:       2,
+	RejectUsername: true,
+	Breached:       EmbeddedBreachedList(),
+}
+
+// Init reads the policy and hashing costs from PASSWORD_* variables, unset ones keep their default.
+// BREACHED_PASSWORDS_FILE replaces the short embedded list of common passwords.
+func Init() {
+	Default.MinLength = intFromEnv("PASSWORD_MIN_LENGTH", Default.MinLength)
+	Default.MaxLength = intFromEnv("PASSWORD_MAX_LENGTH", Default.MaxLength)
+	Default.MinClasses = intFromEnv("PASSWORD_MIN_CLASSES", Default.MinClasses)
+	Default.MinScore = intFromEnv("PASSWORD_MIN_SCORE", Default.MinScore)
+	if value := os.Getenv("PASSWORD_REJECT_USERNAME"); value != "" {
+		Default.RejectUsername = value == "true"
+	}
+
+	DefaultParams.Memory = uint32(intFromEnv("PASSWORD_ARGON2_MEMORY", int(DefaultParams.Memory)))
+	DefaultParams.Iterations = uint32(intFromEnv("PASSWORD_ARGON2_ITERATIONS", int(DefaultParams.Iterations)))
+	DefaultParams.Parallelism = uint8(intFromEnv("PASSWORD_ARGON2_PARALLELISM", int(DefaultParams.Parallelism)))
+	if DefaultParams.Memory < 8*uint32(DefaultParams.Parallelism) || DefaultParams.Iterations == 0 || DefaultParams.Parallelism == 0 {
+		log.Fatal("Invalid PASSWORD_ARGON2_* parameters")
+	}
+
+	switch path := os.Getenv("BREACHED_PASSWORDS_FILE"); path {
+	case "":
+	case "none":
+		Default.Breached = nil
+	default:
+		list, err := OpenBreachedList(path)
+		if err != nil {
+			log.Fatal("Failed to open breached password list:", err)
+		}
+		Default.Breached = list
+	}
+}
+
+// Check returns every rule the password breaks, none when it is acceptable
+func (p Policy) Check(password string, username string) []Violation {
+	violations := []Violation{}
+	add := func(rule string, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(password) < p.MinLength {
+		add(RuleMinLength, "Password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		add(RuleMaxLength, "Password must be at most %d characters", p.MaxLength)
+	}
+	if classes := characterClasses(password); classes < p.MinClasses {
+		add(RuleCharacterClasses, "Password must mix at least %d of lower case letters, upper case letters, digits and symbols", p.MinClasses)
+	}
+	if p.RejectUsername && similarToUsername(password, username) {
+		add(RuleSimilarUsername, "Password must not contain or resemble the username")
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			// A list that cannot be read does not lock everyone out of changing their password
+			slog.Error("breached password list unreadable", "error", err)
+		} else if breached {
+			add(RuleBreached, "Password appears in a list of leaked passwords, choose another one")
+		}
+	}
+	if p.MinScore > 0 && password != "" {
+		scored := password
+		if len(scored) > maxScoredLength {
+			scored = scored[:maxScoredLength]
+		}
+		var inputs []string
+		if username != "" {
+			inputs = []string{username}
+		}
+		if zxcvbn.PasswordStrength(scored, inputs).Score < p.MinScore {
+			add(RuleStrength, "Password is too easy to guess, use a longer phrase or fewer common words")
+		}
+	}
+	return violations
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// similarToUsername catches passwords containing the username, backwards too, or a couple
+// of edits away from it
+func similarToUsername(password string, username string) bool {
+	if len(username) < 3 {
+		return false
+	}
+	p := strings.ToLower(password)
+	u := strings.ToLower(username)
+	return strings.Contains(p, u) || strings.Contains(p, reverse(u)) || editDistance(p, u) <= 2
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatal("Invalid ", name, ": ", value)
+	}
+	return n
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/go-redis/redis/extra/redisotel/v8"
 	"github.com/go-redis/redis/v8"
 	"github.com/joho/godotenv"
 )
@@ -24,6 +25,8 @@ func InitRedis() {
 		Password: os.Getenv("REDIS_PASSWORD"),
 		DB:       0,
 	})
+	// Commands get spans, children of the request span when given the request context
+	RDB.AddHook(redisotel.NewTracingHook())
 
 	if err := RDB.Ping(CTX).Err(); err != nil {
 		log.Fatal("Failed to connect to Redis:", err)
@@ -0,0 +1,198 @@
+package session
+
+import (
+	database "be-golang-todo/src/helper/db"
+	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// Lifetime matches the expiry of the JWT a session is issued with
+	Lifetime = 24 * time.Hour
+
+	// cacheTTL bounds how long a session revoked by hand in the database stays usable
+	cacheTTL = 5 * time.Minute
+
+	// lastSeenResolution is how often the last seen time of a busy session is written
+	lastSeenResolution = time.Minute
+
+	maxUserAgentLength = 512
+)
+
+// Session is a login on one device
+type Session struct {
+	ID         int       `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// Issue records a login from the request and returns the JWT bound to it
+func Issue(r *http.Request, username string, role string) (string, error) {
+	sid, err := utils.RandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+	_, err = database.DB.ExecContext(r.Context(), `INSERT INTO user_session (username, token_id, device, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $6, $7)`,
+		username, sid, DeviceName(userAgent), userAgent, utils.ClientIP(r), now, now.Add(Lifetime))
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateToken(username, role, sid)
+}
+
+// Active tells whether the session of a JWT was not revoked. The answer is cached in Redis,
+// Postgres is only asked on a miss and to update the last seen time once a minute.
+func Active(ctx context.Context, sid string, username string, ip string) (bool, error) {
+	owner, err := config.RDB.Get(ctx, cacheKey(sid)).Result()
+	if err != nil {
+		err = database.DB.QueryRowContext(ctx, `SELECT username FROM user_session
+			WHERE token_id = $1 AND revoked_at IS NULL AND expires_at > $2`, sid, time.Now()).Scan(&owner)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+		config.RDB.Set(ctx, cacheKey(sid), owner, cacheTTL)
+	}
+	if owner == "" || owner != username {
+		return false, nil
+	}
+
+	if first, err := config.RDB.SetNX(ctx, cacheKey(sid)+":seen", 1, lastSeenResolution).Result(); err == nil && first {
+		_, err := database.DB.ExecContext(ctx, "UPDATE user_session SET last_seen_at = $1, ip = COALESCE(NULLIF($2, ''), ip) WHERE token_id = $3",
+			time.Now(), ip, sid)
+		if err != nil {
+			slog.Error("session last seen update failed", "error", err)
+		}
+	}
+	return true, nil
+}
+
+// List returns the active sessions of a user, most recently used first
+func List(ctx context.Context, username string, currentSID string) ([]Session, error) {
+	rows, err := database.DB.QueryContext(ctx, `SELECT id, token_id, COALESCE(device, ''), COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, last_seen_at
+		FROM user_session WHERE username = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC, id DESC`, username, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var sid string
+		if err := rows.Scan(&s.ID, &sid, &s.Device, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		s.Current = sid == currentSID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke ends one session of a user, false when there is no such active session
+func Revoke(ctx context.Context, username string, id int) (bool, error) {
+	var sid string
+	err := database.DB.QueryRowContext(ctx, `UPDATE user_session SET revoked_at = $1
+		WHERE id = $2 AND username = $3 AND revoked_at IS NULL RETURNING token_id`, time.Now(), id, username).Scan(&sid)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	forget(ctx, sid)
+	return true, nil
+}
+
+// RevokeAll ends every session of a user
+func RevokeAll(ctx context.Context, username string) error {
+	rows, err := database.DB.QueryContext(ctx, `UPDATE user_session SET revoked_at = $1
+		WHERE username = $2 AND revoked_at IS NULL RETURNING token_id`, time.Now(), username)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sid string
+		if err := rows.Scan(&sid); err != nil {
+			return err
+		}
+		forget(ctx, sid)
+	}
+	return rows.Err()
+}
+
+// forget marks a session as revoked in the cache, rather than dropping the entry,
+// so that a check racing with the revocation cannot cache it as active again
+func forget(ctx context.Context, sid string) {
+	if err := config.RDB.Set(context.WithoutCancel(ctx), cacheKey(sid), "", cacheTTL).Err(); err != nil {
+		slog.Error("session cache update failed", "error", err)
+	}
+}
+
+func cacheKey(sid string) string {
+	return "session:" + sid
+}
+
+// DeviceName describes the browser and system of a user agent, like "Firefox on Linux"
+func DeviceName(userAgent string) string {
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp/", "Android app"},
+		{"CFNetwork/", "iOS app"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, s := range []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
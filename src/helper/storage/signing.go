@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+var signingKey []byte
+
+func initSigningKey() {
+	if key := os.Getenv("STORAGE_SIGNING_KEY"); key != "" {
+		signingKey = []byte(key)
+		return
+	}
+
+	// Without a configured key, signed URLs stop working after a restart
+	slog.Warn("STORAGE_SIGNING_KEY is not set, using a random key")
+	signingKey = make([]byte, 32)
+	if _, err := rand.Read(signingKey); err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+}
+
+// SetSigningKey overrides the key used to sign download URLs
+func SetSigningKey(key []byte) {
+	signingKey = key
+}
+
+// SignDownload returns the query string granting access to a resource until expires
+func SignDownload(resource string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return fmt.Sprintf("expires=%s&signature=%s", exp, signature(resource, exp))
+}
+
+// VerifyDownload checks a signature produced by SignDownload and that it has not expired
+func VerifyDownload(resource string, expires string, sig string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature(resource, expires)), []byte(sig))
+}
+
+func signature(resource string, expires string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(resource + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
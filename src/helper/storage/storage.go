@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque blobs by key
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var Store BlobStore
+
+// Init configures the blob store from STORAGE_BACKEND ("local" or "s3")
+func Init() {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading env file")
+	}
+
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		Store, err = NewLocalStore(dir)
+	case "s3":
+		Store, err = NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+		})
+	default:
+		log.Fatal("Unknown STORAGE_BACKEND: ", os.Getenv("STORAGE_BACKEND"))
+	}
+
+	if err != nil {
+		log.Fatal("Failed to initialize blob store:", err)
+	}
+
+	initSigningKey()
+}
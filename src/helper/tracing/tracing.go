@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ServiceName names the service in traces unless OTEL_SERVICE_NAME is set
+const ServiceName = "be-golang-todo"
+
+var provider *sdktrace.TracerProvider
+
+// Init exports spans to OTEL_TRACES_EXPORTER, "otlp" or "stdout", and traces nothing when
+// it is unset or "none". The OTLP exporter and the sampler follow the standard OTEL_*
+// variables, like OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_TRACES_SAMPLER. Trace context is
+// propagated in W3C headers either way.
+func Init() {
+	// The file is optional here, the other Init functions insist on it
+	_ = godotenv.Load()
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "", "none":
+		return
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	case "stdout", "console":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		log.Fatal("Invalid OTEL_TRACES_EXPORTER: ", os.Getenv("OTEL_TRACES_EXPORTER"))
+	}
+	if err != nil {
+		log.Fatal("Failed to create the trace exporter: ", err)
+	}
+
+	// Attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take precedence
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		log.Fatal("Failed to describe the trace resource: ", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+}
+
+// Shutdown exports the spans still buffered
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Handler starts a span for every request, continuing the trace of the caller when it
+// sent a traceparent header. Metrics scrapes are not traced.
+func Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/metrics"
+		}),
+	)
+}
@@ -0,0 +1,154 @@
+package twofactor
+
+import (
+	config "be-golang-todo/src/helper/redis"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	period = 30
+
+	RecoveryCodeCount  = 10
+	recoveryCodeLength = 10
+
+	// MaxLoginAttempts is how many codes can be tried with one MFA token
+	MaxLoginAttempts = 5
+	loginTokenTTL    = 5 * time.Minute
+)
+
+// ErrEncryptionKeyMissing is returned when secrets are sealed or opened without MFA_ENCRYPTION_KEY
+var ErrEncryptionKeyMissing = errors.New("MFA_ENCRYPTION_KEY is not set")
+
+var validateOpts = totp.ValidateOpts{Period: period, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// NewKey generates the TOTP secret of a user, issued by MFA_ISSUER
+func NewKey(username string) (*otp.Key, error) {
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "be-golang-todo"
+	}
+	return totp.Generate(totp.GenerateOpts{Issuer: issuer, AccountName: username, Period: period})
+}
+
+// MatchingStep returns the time step of the code among the current one and its neighbors,
+// allowing for clock drift, or -1 when the code matches none. A code whose step is not
+// after lastStep, the step of the last code accepted, is a replay and matches none too.
+func MatchingStep(secret string, code string, now time.Time, lastStep int64) int64 {
+	current := now.Unix() / period
+	for _, step := range []int64{current, current - 1, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*period, 0), validateOpts)
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			if step <= lastStep {
+				return -1
+			}
+			return step
+		}
+	}
+	return -1
+}
+
+// NewRecoveryCodes generates a set of recovery codes, like "abcde-fghij"
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:recoveryCodeLength]
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode drops the dashes and spaces of a recovery code and lowercases it,
+// recovery codes are stored hashed in this form
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// IsRecoveryCode tells recovery codes from six digit TOTP codes
+func IsRecoveryCode(code string) bool {
+	return len(NormalizeRecoveryCode(code)) == recoveryCodeLength
+}
+
+// StartLoginAttempts allows MaxLoginAttempts codes to be tried with the MFA token id
+func StartLoginAttempts(ctx context.Context, id string) error {
+	return config.RDB.Set(ctx, loginAttemptsKey(id), MaxLoginAttempts, loginTokenTTL).Err()
+}
+
+// TakeLoginAttempt uses up one attempt of an MFA token, false when none is left or it was used
+func TakeLoginAttempt(ctx context.Context, id string) (bool, error) {
+	remaining, err := config.RDB.Decr(ctx, loginAttemptsKey(id)).Result()
+	if err != nil {
+		return false, err
+	}
+	if remaining < 0 {
+		config.RDB.Del(ctx, loginAttemptsKey(id))
+		return false, nil
+	}
+	return true, nil
+}
+
+// FinishLogin uses up an MFA token
+func FinishLogin(ctx context.Context, id string) error {
+	return config.RDB.Del(ctx, loginAttemptsKey(id)).Err()
+}
+
+func loginAttemptsKey(id string) string {
+	return "mfa:login:" + id
+}
+
+// EncryptSecret seals a TOTP secret with AES-GCM under MFA_ENCRYPTION_KEY
+func EncryptSecret(secret string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// DecryptSecret opens a secret sealed by EncryptSecret, failing when MFA_ENCRYPTION_KEY changed since
+func DecryptSecret(sealed string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed TOTP secret")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	return string(secret), err
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	passphrase := os.Getenv("MFA_ENCRYPTION_KEY")
+	if passphrase == "" {
+		return nil, ErrEncryptionKeyMissing
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -9,14 +9,17 @@ import (
 
 var jwtSecret = []byte("your-secret-key") // Replace with an environment variable in production
 
-// GenerateToken generates a JWT token for a given username
-func GenerateToken(username string) (string, error) {
+// GenerateToken generates a JWT token for a given username and role, bound to a login session
+func GenerateToken(username string, role string, sessionID string) (string, error) {
 	// Define the token expiration time
 	expirationTime := time.Now().Add(24 * time.Hour) // Token valid for 24 hours
 
 	// Create JWT claims including standard and custom fields
 	claims := jwt.MapClaims{
 		"username": username,
+		"role":     role,
+		"sid":      sessionID,
+		"iat":      time.Now().Unix(),
 		"exp":      expirationTime.Unix(),
 	}
 
@@ -54,3 +57,63 @@ func DecodeToken(tokenString string) (jwt.MapClaims, error) {
 
 	return nil, errors.New("failed to parse claims")
 }
+
+// mfaTokenLifetime is how long a user has to enter the second factor after the password
+const mfaTokenLifetime = 5 * time.Minute
+
+// GenerateMFAToken issues the short lived token proving that the password of a user with
+// two-factor authentication was checked. It is only accepted by the second step of the login.
+func GenerateMFAToken(username string, id string) (string, error) {
+	claims := jwt.MapClaims{
+		"username": username,
+		"purpose":  "mfa",
+		"jti":      id,
+		"exp":      time.Now().Add(mfaTokenLifetime).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// DecodeMFAToken returns the username and id of a token issued by GenerateMFAToken
+func DecodeMFAToken(tokenString string) (string, string, error) {
+	claims, err := DecodeToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+	username, _ := claims["username"].(string)
+	id, _ := claims["jti"].(string)
+	if claims["purpose"] != "mfa" || username == "" || id == "" {
+		return "", "", errors.New("not an MFA token")
+	}
+	return username, id, nil
+}
+
+// emailTokenLifetime is how long the link in a verification email stays valid
+const emailTokenLifetime = 24 * time.Hour
+
+// GenerateEmailToken issues the signed token sent to verify the email address of a user.
+// The id makes it single use, the caller records it when the token is issued.
+func GenerateEmailToken(username string, email string, id string) (string, error) {
+	claims := jwt.MapClaims{
+		"username": username,
+		"email":    email,
+		"purpose":  "email_verification",
+		"jti":      id,
+		"exp":      time.Now().Add(emailTokenLifetime).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+}
+
+// DecodeEmailToken returns the username, email and id of a token issued by GenerateEmailToken
+func DecodeEmailToken(tokenString string) (string, string, string, error) {
+	claims, err := DecodeToken(tokenString)
+	if err != nil {
+		return "", "", "", err
+	}
+	username, _ := claims["username"].(string)
+	email, _ := claims["email"].(string)
+	id, _ := claims["jti"].(string)
+	if claims["purpose"] != "email_verification" || username == "" || email == "" || id == "" {
+		return "", "", "", errors.New("not an email verification token")
+	}
+	return username, email, id, nil
+}
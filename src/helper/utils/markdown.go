@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown renders GitHub flavored Markdown. Raw HTML in the source is not
+// rendered and unsafe links are dropped, so the output can be embedded as is.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// mentionPattern matches @username, a mention never ends with a dot or a dash so that
+// punctuation after it, as in "thanks @alice.", is not taken for part of the name
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_](?:[A-Za-z0-9_.-]*[A-Za-z0-9_])?)`)
+
+// RenderMarkdown converts Markdown text to HTML
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ExtractMentions returns the distinct @usernames mentioned in a text, in order of appearance
+func ExtractMentions(text string) []string {
+	seen := make(map[string]bool)
+	var mentions []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := match[1]
+		if !seen[username] {
+			seen[username] = true
+			mentions = append(mentions, username)
+		}
+	}
+	return mentions
+}
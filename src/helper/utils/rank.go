@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// rankDigits is the alphabet used for position keys. Keys compare correctly
+// with plain byte-wise string comparison (COLLATE "C" in PostgreSQL).
+const rankDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var ErrInvalidRank = errors.New("invalid rank keys")
+
+// RankBetween returns a position key that sorts strictly between a and b.
+// An empty a means "before everything" and an empty b means "after everything",
+// so RankBetween("", "") returns a key for the first item of an empty column.
+func RankBetween(a, b string) (string, error) {
+	if !validRank(a) || !validRank(b) || (a != "" && b != "" && a >= b) {
+		return "", ErrInvalidRank
+	}
+	return rankMidpoint(a, b), nil
+}
+
+func validRank(key string) bool {
+	if key == "" {
+		return true
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(rankDigits, key[i]) < 0 {
+			return false
+		}
+	}
+	// A trailing zero digit would leave no room to insert before the key
+	return key[len(key)-1] != rankDigits[0]
+}
+
+func rankMidpoint(a, b string) string {
+	if b != "" {
+		// Skip the common prefix, treating a as padded with zero digits
+		n := 0
+		for n < len(b) {
+			digitA := rankDigits[0]
+			if n < len(a) {
+				digitA = a[n]
+			}
+			if digitA != b[n] {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + rankMidpoint(rest, b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(rankDigits, a[0])
+	}
+	digitB := len(rankDigits)
+	if b != "" {
+		digitB = strings.IndexByte(rankDigits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(rankDigits[(digitA+digitB+1)/2])
+	}
+
+	// The first digits are consecutive
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(rankDigits[digitA]) + rankMidpoint(rest, "")
+}
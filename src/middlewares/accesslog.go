@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/metrics"
+	"be-golang-todo/src/helper/utils"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDPattern is what an X-Request-ID from the client must look like to be kept
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// secretParams are route parameters holding credentials, like the token of a calendar feed
+// URL, which are never written to logs or traces
+var secretParams = map[string]bool{"token": true}
+
+// AccessLog serves the router, giving every request an X-Request-ID, taken from the client
+// when it sent a sane one, and a logger carrying that ID which handlers get with
+// logging.From. One line is written and the request metrics are updated once it is answered.
+func AccessLog(router *httprouter.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID, _ = utils.RandomToken(12)
+			r.Header.Set("X-Request-ID", requestID)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		route := RoutePattern(router, r.Method, r.URL.Path)
+		path := redactedPath(router, r.Method, r.URL.Path)
+		logger := slog.Default().With("request_id", requestID)
+
+		// The span started by tracing.Handler is named after the route, and log lines
+		// carry its trace ID to find the trace of a request from its logs
+		if span := trace.SpanFromContext(r.Context()); span.SpanContext().IsValid() {
+			if route != "" {
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			if path != r.URL.Path {
+				span.SetAttributes(semconv.URLPath(path))
+			}
+			logger = logger.With("trace_id", span.SpanContext().TraceID().String())
+		}
+		r = r.WithContext(logging.NewContext(r.Context(), logger))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		router.ServeHTTP(recorder, r)
+		elapsed := time.Since(start)
+		metrics.ObserveRequest(r.Method, route, recorder.status, elapsed)
+
+		// The line is recorded without a source, it would always point here
+		record := slog.NewRecord(time.Now(), slog.LevelInfo, "request", 0)
+		record.AddAttrs(
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", path),
+			slog.Int("status", recorder.status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+			slog.String("ip", utils.ClientIP(r)),
+		)
+		logger = logging.From(r)
+		if logger.Enabled(r.Context(), slog.LevelInfo) {
+			logger.Handler().Handle(r.Context(), record)
+		}
+	})
+}
+
+// redactedPath returns the request path with the values of secret parameters replaced by
+// the parameter name, so /calendar/abc becomes /calendar/:token
+func redactedPath(router *httprouter.Router, method string, path string) string {
+	_, ps, _ := router.Lookup(method, path)
+	for _, param := range ps {
+		if !secretParams[param.Key] || param.Value == "" {
+			continue
+		}
+		segments := strings.Split(path, "/")
+		for i := len(segments) - 1; i >= 0; i-- {
+			if segments[i] == param.Value {
+				segments[i] = ":" + param.Key
+				break
+			}
+		}
+		path = strings.Join(segments, "/")
+	}
+	return path
+}
+
+// statusRecorder remembers the status and size of a response passing through
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streamed responses, like exports, streaming
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,286 @@
+package middlewares
+
+import (
+	"be-golang-todo/src/helper/logging"
+	config "be-golang-todo/src/helper/redis"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	idempotencyTTL = 24 * time.Hour
+
+	// idempotencyLockTTL bounds how long a request that never finished, after a crash, blocks its key.
+	// It is renewed while the request runs, so that a slow import is not run twice by a retry.
+	idempotencyLockTTL = time.Minute
+
+	// maxIdempotencyKeyLength bounds the client supplied part of the Redis key
+	maxIdempotencyKeyLength = 255
+
+	// Request bodies above this size are spooled to a temporary file while being hashed
+	idempotencyMemoryLimit = 1 << 20
+
+	// Responses above this size are not stored, a retry then runs the request again
+	maxStoredResponseSize = 1 << 20
+
+	// defaultMaxIdempotentBody matches the import limit, attachments may allow more
+	defaultMaxIdempotentBody = 10 << 20
+)
+
+// replayedHeaders are the response headers stored along with the status and body
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Location"}
+
+type storedResponse struct {
+	Fingerprint string            `json:"fingerprint"`
+	Done        bool              `json:"done"`
+	Status      int               `json:"status,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// Idempotent makes mutating requests carrying an Idempotency-Key header safe to retry.
+// The first response is stored in Redis per user and key and replayed to retries of the
+// same request, reusing a key for a different request is rejected. Server errors are not
+// stored so that they can be retried. It expects the Username header set by ProtectedHandler.
+func Idempotent(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r, ps)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxIdempotentBody())
+		fingerprint, body, err := fingerprintRequest(r)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+		r.Body = body
+
+		redisKey := "idempotency:" + r.Header.Get("Username") + ":" + key
+		pending, _ := json.Marshal(storedResponse{Fingerprint: fingerprint})
+		acquired, err := config.RDB.SetNX(r.Context(), redisKey, pending, idempotencyLockTTL).Result()
+		if err != nil {
+			// Without Redis the request still goes through, only unprotected
+			logging.From(r).Error("idempotent response not stored", "error", err)
+			next(w, r, ps)
+			return
+		}
+
+		if !acquired {
+			replayResponse(w, r, redisKey, fingerprint)
+			return
+		}
+
+		// The outcome is recorded even when the client hung up meanwhile, it is what its retry gets
+		ctx := context.WithoutCancel(r.Context())
+		recorder := &responseRecorder{ResponseWriter: w}
+		release := holdLock(ctx, redisKey)
+		next(recorder, r, ps)
+		release()
+
+		if recorder.status >= http.StatusInternalServerError || recorder.overflow {
+			config.RDB.Del(ctx, redisKey)
+			return
+		}
+		stored := storedResponse{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      recorder.statusCode(),
+			Header:      make(map[string]string),
+			Body:        recorder.body.Bytes(),
+		}
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				stored.Header[name] = value
+			}
+		}
+		data, _ := json.Marshal(stored)
+		if err := config.RDB.Set(ctx, redisKey, data, idempotencyTTL).Err(); err != nil {
+			logging.From(r).Error("idempotent response not stored", "error", err)
+		}
+	}
+}
+
+func replayResponse(w http.ResponseWriter, r *http.Request, redisKey string, fingerprint string) {
+	data, err := config.RDB.Get(r.Context(), redisKey).Bytes()
+	if err != nil {
+		// The key expired or was released by a failed first attempt in the meantime
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+
+	var stored storedResponse
+	if err := json.Unmarshal(data, &stored); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if stored.Fingerprint != fingerprint {
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if !stored.Done {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+
+	for name, value := range stored.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+// holdLock renews the lock on a key until the returned function is called
+func holdLock(ctx context.Context, redisKey string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(idempotencyLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				config.RDB.PExpire(ctx, redisKey, idempotencyLockTTL)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// maxIdempotentBody is the largest body any handler accepts, larger ones are refused
+// before being spooled. Handlers apply their own, possibly lower, limits.
+func maxIdempotentBody() int64 {
+	limit := int64(defaultMaxIdempotentBody)
+	if upload, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && upload+64<<10 > limit {
+		limit = upload + 64<<10
+	}
+	return limit
+}
+
+// fingerprintRequest hashes the method, URL and body of a request and returns a reader
+// over the consumed body, buffered in memory or spooled to a temporary file when large.
+func fingerprintRequest(r *http.Request) (string, io.ReadCloser, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+
+	if r.Body == nil {
+		return hex.EncodeToString(h.Sum(nil)), io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	defer r.Body.Close()
+
+	var buf bytes.Buffer
+	n, err := io.Copy(io.MultiWriter(h, &buf), io.LimitReader(r.Body, idempotencyMemoryLimit+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if n <= idempotencyMemoryLimit {
+		return hex.EncodeToString(h.Sum(nil)), io.NopCloser(&buf), nil
+	}
+
+	body, err := spoolBody(h, &buf, r.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), body, nil
+}
+
+// spoolBody writes what was already read and the rest of the body to a temporary file,
+// which is removed when the returned reader is closed
+func spoolBody(h hash.Hash, head io.Reader, rest io.Reader) (io.ReadCloser, error) {
+	f, err := os.CreateTemp("", "idempotency-*")
+	if err != nil {
+		return nil, err
+	}
+	body := &tempFileBody{f}
+	if _, err := io.Copy(f, head); err != nil {
+		body.Close()
+		return nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(h, f), rest); err != nil {
+		body.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		body.Close()
+		return nil, err
+	}
+	return body, nil
+}
+
+type tempFileBody struct {
+	*os.File
+}
+
+func (b *tempFileBody) Close() error {
+	err := b.File.Close()
+	os.Remove(b.File.Name())
+	return err
+}
+
+// responseRecorder passes the response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.body.Len()+len(b) > maxStoredResponseSize {
+		rec.overflow = true
+	} else if !rec.overflow {
+		rec.body.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
@@ -1,6 +1,9 @@
 package middlewares
 
 import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/session"
 	"be-golang-todo/src/helper/utils"
 	"net/http"
 	"strings"
@@ -20,22 +23,105 @@ func ProtectedHandler(next httprouter.Handle) httprouter.Handle {
 		// Extract the token string by trimming the "Bearer " prefix
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Decode and validate the JWT token
-		claims, err := utils.DecodeToken(tokenString)
-		if err != nil {
-			http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
-			return
+		var username, role, sessionID string
+		var issuedAt int64
+		if strings.HasPrefix(tokenString, account.TokenPrefix) {
+			// Personal access tokens reach only the routes their scopes allow and act with the account's role
+			tokenUser, scopes, err := account.AuthenticateToken(r.Context(), tokenString)
+			if err == account.ErrInvalidToken {
+				http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				logging.From(r).Error("database error", "error", err)
+				http.Error(w, "Database error", http.StatusInternalServerError)
+				return
+			}
+			if !allowedByScopes(r, scopes) {
+				http.Error(w, "Forbidden: token lacks the required scope", http.StatusForbidden)
+				return
+			}
+			username = tokenUser
+		} else {
+			// Decode and validate the JWT token
+			claims, err := utils.DecodeToken(tokenString)
+			if err != nil {
+				http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			// Tokens issued for a single purpose, like the second step of a login, are not sessions
+			if _, ok := claims["purpose"]; ok {
+				http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			// Get username from claims and type assert to a string
+			claimUsername, ok := claims["username"].(string)
+			if !ok {
+				http.Error(w, "Unauthorized: invalid token claims", http.StatusUnauthorized)
+				return
+			}
+			username = claimUsername
+
+			if iat, ok := claims["iat"].(float64); ok {
+				issuedAt = int64(iat)
+			}
+
+			// Tokens issued before sessions were recorded carry no sid and stay valid until they expire
+			sessionID, _ = claims["sid"].(string)
+			if sessionID != "" {
+				active, err := session.Active(r.Context(), sessionID, username, utils.ClientIP(r))
+				if err != nil {
+					logging.From(r).Error("database error", "error", err)
+					http.Error(w, "Database error", http.StatusInternalServerError)
+					return
+				}
+				if !active {
+					http.Error(w, "Unauthorized: session was revoked, please log in again", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			// Tokens issued before roles existed carry none
+			role, _ = claims["role"].(string)
+			if role == "" {
+				role = account.RoleUser
+			}
 		}
 
-		// Get username from claims and type assert to a string
-		username, ok := claims["username"].(string)
-		if !ok {
-			http.Error(w, "Unauthorized: invalid token claims", http.StatusUnauthorized)
+		// The account is checked on every request so that disabling it takes effect immediately
+		acc, err := account.Get(r.Context(), username)
+		if err == account.ErrNotFound {
+			http.Error(w, "Unauthorized: account does not exist", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if acc.Disabled {
+			http.Error(w, "Unauthorized: account is disabled", http.StatusUnauthorized)
+			return
+		}
+		// A JWT without iat predates session invalidation and is treated as issued at the epoch,
+		// personal access tokens are revoked on their own
+		if acc.SessionsValidAfter != nil && !strings.HasPrefix(tokenString, account.TokenPrefix) && issuedAt < acc.SessionsValidAfter.Unix() {
+			http.Error(w, "Unauthorized: session ended, please log in again", http.StatusUnauthorized)
+			return
+		}
+		if role == "" {
+			role = acc.Role
+		} else if acc.Role != role {
+			http.Error(w, "Unauthorized: role changed, please log in again", http.StatusUnauthorized)
 			return
 		}
+		r.Header.Set("Role", role)
+		r.Header.Set("Session-Id", sessionID)
 
-		// Proceed to the next handler with the response writer, request, and params
+		// Proceed to the next handler with the response writer, request, and params,
+		// mutating requests with an Idempotency-Key are deduplicated per user
 		r.Header.Set("username", username)
-		next(w, r, ps)
+		logging.With(r, "user", username)
+		Idempotent(next)(w, r, ps)
 	}
 }
@@ -0,0 +1,196 @@
+package middlewares
+
+import (
+	"be-golang-todo/src/helper/account"
+	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// KeyFunc tells which client a request counts against
+type KeyFunc func(r *http.Request) string
+
+// Limit allows Requests per Window to each client of a group of routes sharing the Name
+type Limit struct {
+	Name     string
+	Requests int
+	Window   time.Duration
+	Key      KeyFunc
+}
+
+// ByIP counts requests per client address
+func ByIP(r *http.Request) string {
+	return "ip:" + utils.ClientIP(r)
+}
+
+// ByClient counts requests per personal access token, else per user. It relies on the
+// Username header set by ProtectedHandler and must only wrap handlers behind it.
+func ByClient(r *http.Request) string {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if strings.HasPrefix(token, account.TokenPrefix) {
+		return "token:" + utils.HashToken(token)[:16]
+	}
+	if username := r.Header.Get("Username"); username != "" {
+		return "user:" + username
+	}
+	return ByIP(r)
+}
+
+// RateLimit rejects requests above the limit with 429 and reports the quota in the
+// RateLimit-* headers. RATE_LIMIT_<NAME>, like "20/1m", overrides the limit and "off"
+// disables it. Counts are kept in Redis with a sliding window, or in memory while Redis
+// cannot be reached, which then makes them per instance.
+func RateLimit(limit Limit, next httprouter.Handle) httprouter.Handle {
+	limit, enabled := limitFromEnv(limit)
+	if !enabled {
+		return next
+	}
+	policy := fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds()))
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		now := time.Now()
+		key := "ratelimit:" + limit.Name + ":" + limit.Key(r)
+		current, previous, err := redisWindows.hit(r.Context(), key, limit.Window, now)
+		if err != nil {
+			logRateLimitFallback(err)
+			current, previous, _ = memoryWindows.hit(r.Context(), key, limit.Window, now)
+		}
+
+		// The previous window counts for the part of it still inside the sliding window
+		elapsed := time.Duration(now.UnixNano() % int64(limit.Window))
+		weight := 1 - float64(elapsed)/float64(limit.Window)
+		count := int(math.Ceil(float64(previous)*weight)) + int(current)
+		reset := int(math.Ceil((limit.Window - elapsed).Seconds()))
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(0, limit.Requests-count)))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+		w.Header().Set("RateLimit-Policy", policy)
+
+		if count > limit.Requests {
+			w.Header().Set("Retry-After", strconv.Itoa(reset))
+			http.Error(w, "Too many requests, slow down", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r, ps)
+	}
+}
+
+func limitFromEnv(limit Limit) (Limit, bool) {
+	if limit.Key == nil {
+		limit.Key = ByIP
+	}
+	name := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(limit.Name, "-", "_"))
+	value := os.Getenv(name)
+	if value == "" {
+		return limit, limit.Requests > 0
+	}
+	if value == "off" {
+		return limit, false
+	}
+
+	requests, window, ok := strings.Cut(value, "/")
+	n, err := strconv.Atoi(requests)
+	d, err2 := time.ParseDuration(window)
+	if !ok || err != nil || err2 != nil || n <= 0 || d < time.Second {
+		log.Fatal("Invalid ", name, ": ", value)
+	}
+	limit.Requests, limit.Window = n, d
+	return limit, true
+}
+
+// windowStore counts the hits of a key in fixed windows, returning the count of the
+// current window including this hit and the count of the previous one
+type windowStore interface {
+	hit(ctx context.Context, key string, window time.Duration, now time.Time) (int64, int64, error)
+}
+
+var (
+	redisWindows  windowStore = redisWindowStore{}
+	memoryWindows             = &memoryWindowStore{counts: make(map[string]memoryWindow)}
+)
+
+type redisWindowStore struct{}
+
+func (redisWindowStore) hit(ctx context.Context, key string, window time.Duration, now time.Time) (int64, int64, error) {
+	if config.RDB == nil {
+		return 0, 0, fmt.Errorf("redis is not initialized")
+	}
+	index := now.UnixNano() / int64(window)
+	currentKey := key + ":" + strconv.FormatInt(index, 10)
+	previousKey := key + ":" + strconv.FormatInt(index-1, 10)
+
+	pipe := config.RDB.TxPipeline()
+	incr := pipe.Incr(ctx, currentKey)
+	pipe.PExpire(ctx, currentKey, 2*window)
+	previous := pipe.Get(ctx, previousKey)
+	if _, err := pipe.Exec(ctx); err != nil && incr.Err() != nil {
+		return 0, 0, err
+	}
+	// A missing previous window is not an error, it counts as zero
+	previousCount, _ := previous.Int64()
+	return incr.Val(), previousCount, nil
+}
+
+type memoryWindow struct {
+	count   int64
+	expires time.Time
+}
+
+type memoryWindowStore struct {
+	mu     sync.Mutex
+	counts map[string]memoryWindow
+	hits   int
+}
+
+func (s *memoryWindowStore) hit(ctx context.Context, key string, window time.Duration, now time.Time) (int64, int64, error) {
+	index := now.UnixNano() / int64(window)
+	currentKey := key + ":" + strconv.FormatInt(index, 10)
+	previousKey := key + ":" + strconv.FormatInt(index-1, 10)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired windows are swept now and then rather than on a timer
+	s.hits++
+	if s.hits%1000 == 0 {
+		for k, c := range s.counts {
+			if now.After(c.expires) {
+				delete(s.counts, k)
+			}
+		}
+	}
+
+	current := s.counts[currentKey]
+	current.count++
+	current.expires = now.Add(2 * window)
+	s.counts[currentKey] = current
+	return current.count, s.counts[previousKey].count, nil
+}
+
+var (
+	fallbackLogMu   sync.Mutex
+	fallbackLogNext time.Time
+)
+
+// logRateLimitFallback reports Redis failures at most once a minute, not once per request
+func logRateLimitFallback(err error) {
+	fallbackLogMu.Lock()
+	defer fallbackLogMu.Unlock()
+	if now := time.Now(); now.After(fallbackLogNext) {
+		fallbackLogNext = now.Add(time.Minute)
+		slog.Warn("rate limit counting in memory, Redis unavailable", "error", err)
+	}
+}
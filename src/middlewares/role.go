@@ -0,0 +1,20 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RequireRole lets only users with the given role through. It relies on the Role header
+// set by ProtectedHandler and must be wrapped by it:
+// ProtectedHandler(RequireRole(account.RoleAdmin, handler)).
+func RequireRole(role string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if r.Header.Get("Role") != role {
+			http.Error(w, "Forbidden: requires the "+role+" role", http.StatusForbidden)
+			return
+		}
+		next(w, r, ps)
+	}
+}
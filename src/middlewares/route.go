@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// StaticSegment routes requests whose named parameter equals value to static, and all others to param.
+// httprouter cannot register /tasks/export next to /tasks/:id, so such static routes are dispatched from the parameter route.
+// A nil param handle answers 404 for every other value.
+func StaticSegment(name string, value string, static httprouter.Handle, param httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ps.ByName(name) == value {
+			static(w, r, ps)
+			return
+		}
+		if param == nil {
+			http.NotFound(w, r)
+			return
+		}
+		param(w, r, ps)
+	}
+}
+
+// RoutePattern returns the pattern of the route matching a request path, like /tasks/:id,
+// or "" when none does. httprouter only reports parameter values, so each value is put back
+// as its name, checking with the router that the segment is the parameter and not a static
+// segment that happens to be equal, as /tasks/tasks would be.
+func RoutePattern(router *httprouter.Router, method string, path string) string {
+	handle, ps, _ := router.Lookup(method, path)
+	if handle == nil {
+		return ""
+	}
+
+	segments := strings.Split(path, "/")
+	next := 0
+	for i, param := range ps {
+		// Only a catch-all parameter, which is always last, holds the rest of the path
+		if strings.HasPrefix(param.Value, "/") {
+			prefix := strings.TrimSuffix(path[:len(path)-len(param.Value)], "/")
+			return patternOf(segments, prefix) + "/*" + param.Key
+		}
+		for j := next; j < len(segments); j++ {
+			if segments[j] != param.Value {
+				continue
+			}
+			segments[j] = "\x00"
+			_, probed, _ := router.Lookup(method, strings.Join(segments, "/"))
+			if len(probed) > i && probed[i].Value == "\x00" {
+				segments[j] = ":" + param.Key
+				next = j + 1
+				break
+			}
+			segments[j] = param.Value
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// patternOf returns the leading segments covering prefix, with the parameters already named
+func patternOf(segments []string, prefix string) string {
+	n := strings.Count(prefix, "/") + 1
+	return strings.Join(segments[:n], "/")
+}
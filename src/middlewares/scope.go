@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"be-golang-todo/src/helper/account"
+	"net/http"
+	"strings"
+)
+
+// routeResources maps the first path segment of a route to the resource of its scopes.
+// Personal access tokens cannot reach routes missing here, such as /tokens itself.
+var routeResources = map[string]string{
+	"tasks":         "tasks",
+	"board":         "tasks",
+	"sync":          "tasks",
+	"attachments":   "tasks",
+	"timer":         "time",
+	"time-entries":  "time",
+	"reports":       "time",
+	"notifications": "notifications",
+	"admin":         "admin",
+}
+
+// requiredScope returns the scope a personal access token needs for a request,
+// or "" when no token may make it. Only GET and HEAD requests are reads.
+func requiredScope(r *http.Request) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	resource, ok := routeResources[segment]
+	if !ok {
+		return ""
+	}
+
+	// Time tracking on a task, /tasks/:id/timer and /tasks/:id/time-entries, belongs to the time scopes
+	if resource == "tasks" && (strings.Contains(r.URL.Path, "/timer/") || strings.HasSuffix(r.URL.Path, "/time-entries")) {
+		resource = "time"
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+// allowedByScopes checks the scopes of a personal access token against the request
+func allowedByScopes(r *http.Request, scopes []string) bool {
+	required := requiredScope(r)
+	return required != "" && account.HasScope(scopes, required)
+}
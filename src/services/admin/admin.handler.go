@@ -0,0 +1,413 @@
+package admin
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/helper/audit"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/password"
+	"be-golang-todo/src/helper/session"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// userSummary is a user as listed to admins, without any secret
+type userSummary struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username"`
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+type auditEntry struct {
+	ID        int             `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	IP        string          `json:"ip"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type resetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func ListUsersHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	// Deleted accounts only remain to keep their username reserved
+	where := " WHERE deleted_at IS NULL AND username ILIKE $1"
+	args := []interface{}{"%" + r.URL.Query().Get("search") + "%"}
+	if role := r.URL.Query().Get("role"); role != "" {
+		where += " AND role = $2"
+		args = append(args, role)
+	}
+
+	query := fmt.Sprintf("SELECT id, username, role, disabled_at FROM \"user\"%s ORDER BY id LIMIT $%d OFFSET $%d", where, len(args)+1, len(args)+2)
+	rows, err := database.DB.QueryContext(r.Context(), query, append(args, limit, offset)...)
+	if err != nil {
+		logging.From(r).Error("failed to retrieve users", "error", err)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []userSummary{}
+	for rows.Next() {
+		var u userSummary
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.DisabledAt); err != nil {
+			logging.From(r).Error("failed to scan user", "error", err)
+			http.Error(w, "Failed to scan user", http.StatusInternalServerError)
+			return
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		logging.From(r).Error("failed to retrieve users", "error", err)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	var totalUsers int
+	if err := database.DB.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM \"user\""+where, args...).Scan(&totalUsers); err != nil {
+		logging.From(r).Error("failed to count users", "error", err)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+		"pagination": map[string]interface{}{
+			"current_page": page,
+			"total_pages":  (totalUsers + limit - 1) / limit,
+			"total_users":  totalUsers,
+		},
+	})
+}
+
+func DisableUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setDisabled(w, r, ps, true)
+}
+
+func EnableUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	setDisabled(w, r, ps, false)
+}
+
+func setDisabled(w http.ResponseWriter, r *http.Request, ps httprouter.Params, disabled bool) {
+	username, ok := targetUser(w, r, ps)
+	if !ok {
+		return
+	}
+
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+	// Disabling keeps the original date when the account already is
+	if _, err := database.DB.ExecContext(r.Context(), "UPDATE \"user\" SET disabled_at = CASE WHEN $1::timestamp IS NULL THEN NULL ELSE COALESCE(disabled_at, $1) END WHERE username = $2",
+		disabledAt, username); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Tokens of the account are checked against the cached state on every request
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+
+	action := audit.ActionUserEnabled
+	if disabled {
+		action = audit.ActionUserDisabled
+	}
+	audit.Record(r.Context(), r.Header.Get("Username"), action, username, utils.ClientIP(r), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func SetUserRoleHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateSetRoleRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	username, ok := targetUser(w, r, ps)
+	if !ok {
+		return
+	}
+
+	if _, err := database.DB.ExecContext(r.Context(), "UPDATE \"user\" SET role = $1 WHERE username = $2", req.Role, username); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	// Tokens carrying the previous role stop working, the user has to log in again
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+	audit.Record(r.Context(), r.Header.Get("Username"), audit.ActionUserRole, username, utils.ClientIP(r), audit.Details{"role": req.Role})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	username, ok := targetUser(w, r, ps)
+	if !ok {
+		return
+	}
+
+	// Validate the request data
+	errors := validateResetPasswordRequest(req, username)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	hashedPassword, err := password.Hash(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := database.DB.ExecContext(r.Context(), "UPDATE \"user\" SET password = $1 WHERE username = $2", hashedPassword, username); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := account.EndSessions(r.Context(), database.DB, username); err != nil {
+		logging.From(r).Error("ending sessions failed", "error", err)
+	}
+	if err := session.RevokeAll(r.Context(), username); err != nil {
+		logging.From(r).Error("session revocation failed", "error", err)
+	}
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+	audit.Record(r.Context(), r.Header.Get("Username"), audit.ActionPasswordReset, username, utils.ClientIP(r), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUserHandler deletes an account the way users delete their own, keeping the username
+// reserved. Tasks, comments and time entries stay, they are shared with other users.
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	username, ok := targetUser(w, r, ps)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := account.Tombstone(r.Context(), tx, username); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+	if err := session.RevokeAll(r.Context(), username); err != nil {
+		logging.From(r).Error("session revocation failed", "error", err)
+	}
+	audit.Record(r.Context(), r.Header.Get("Username"), audit.ActionUserDeleted, username, utils.ClientIP(r), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetStatsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var users struct {
+		Total    int `json:"total"`
+		Admins   int `json:"admins"`
+		Disabled int `json:"disabled"`
+	}
+	var tasks struct {
+		Total    int            `json:"total"`
+		Deleted  int            `json:"deleted"`
+		ByStatus map[string]int `json:"by_status"`
+	}
+	var attachments struct {
+		Count int   `json:"count"`
+		Bytes int64 `json:"bytes"`
+	}
+	var comments, loggedMinutes int
+
+	err := database.DB.QueryRowContext(r.Context(), `SELECT COUNT(*), COUNT(*) FILTER (WHERE role = $1), COUNT(*) FILTER (WHERE disabled_at IS NOT NULL)
+		FROM "user" WHERE deleted_at IS NULL`, account.RoleAdmin).Scan(&users.Total, &users.Admins, &users.Disabled)
+	if err == nil {
+		err = database.DB.QueryRowContext(r.Context(), `SELECT COUNT(*) FILTER (WHERE deleted_at IS NULL), COUNT(*) FILTER (WHERE deleted_at IS NOT NULL)
+			FROM task`).Scan(&tasks.Total, &tasks.Deleted)
+	}
+	if err == nil {
+		tasks.ByStatus, err = tasksByStatus(r.Context())
+	}
+	if err == nil {
+		err = database.DB.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM comment WHERE deleted_at IS NULL").Scan(&comments)
+	}
+	if err == nil {
+		err = database.DB.QueryRowContext(r.Context(), "SELECT COUNT(*), COALESCE(SUM(size), 0) FROM attachment").Scan(&attachments.Count, &attachments.Bytes)
+	}
+	if err == nil {
+		err = database.DB.QueryRowContext(r.Context(), `SELECT COALESCE(SUM(EXTRACT(EPOCH FROM ended_at - started_at)) / 60, 0)::integer
+			FROM time_entry WHERE ended_at IS NOT NULL`).Scan(&loggedMinutes)
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":          users,
+		"tasks":          tasks,
+		"comments":       comments,
+		"attachments":    attachments,
+		"logged_minutes": loggedMinutes,
+	})
+}
+
+// GetAuditLogHandler lists the audit trail, newest first, filtered by ?action= and ?target=
+func GetAuditLogHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	query := "SELECT id, COALESCE(actor, ''), action, COALESCE(target, ''), COALESCE(ip, ''), details, created_at FROM audit_log WHERE 1=1"
+	args := []interface{}{}
+	if action := r.URL.Query().Get("action"); action != "" {
+		args = append(args, action)
+		query += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+	if target := r.URL.Query().Get("target"); target != "" {
+		args = append(args, target)
+		query += fmt.Sprintf(" AND target = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := database.DB.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		logging.From(r).Error("failed to retrieve audit log", "error", err)
+		http.Error(w, "Failed to retrieve audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.IP, &e.Details, &e.CreatedAt); err != nil {
+			http.Error(w, "Failed to scan audit entry", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+func tasksByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := database.DB.QueryContext(ctx, "SELECT COALESCE(status, 'pending'), COUNT(*) FROM task WHERE deleted_at IS NULL GROUP BY 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+// targetUser resolves the :id of the user an admin acts on. Admins cannot act on their
+// own account, so that the last admin cannot lock everyone out.
+func targetUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (string, bool) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return "", false
+	}
+
+	var username string
+	// Accounts deleted by their owner stay as tombstones reserving the username and cannot be revived
+	err = database.DB.QueryRowContext(r.Context(), "SELECT username FROM \"user\" WHERE id = $1 AND deleted_at IS NULL", id).Scan(&username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return "", false
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return "", false
+	}
+
+	if username == r.Header.Get("Username") {
+		http.Error(w, "Admins cannot change their own account here", http.StatusConflict)
+		return "", false
+	}
+	return username, true
+}
@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/helper/password"
+)
+
+func validateResetPasswordRequest(req resetPasswordRequest, username string) map[string]interface{} {
+	errors := make(map[string]interface{})
+	if len(req.Password) == 0 {
+		errors["password"] = "Password is required"
+	} else if violations := password.Default.Check(req.Password, username); len(violations) > 0 {
+		errors["password"] = violations
+	}
+	return errors
+}
+
+func validateSetRoleRequest(req setRoleRequest) map[string]string {
+	errors := make(map[string]string)
+	if !account.IsValidRole(req.Role) {
+		errors["role"] = "Role must be user or admin"
+	}
+	return errors
+}
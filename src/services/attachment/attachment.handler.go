@@ -0,0 +1,356 @@
+package attachment
+
+import (
+	"be-golang-todo/models"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/storage"
+	"be-golang-todo/src/services/task"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultMaxUploadBytes = 10 << 20
+	downloadURLLifetime   = 15 * time.Minute
+)
+
+func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	maxBytes := maxUploadBytes()
+	// Leave some room for the multipart envelope around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64<<10)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+		return
+	}
+
+	// Find the "file" part and spool it to disk while hashing it
+	var filename string
+	var tmp *os.File
+	hash := sha256.New()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		filename = part.FileName()
+		tmp, err = os.CreateTemp("", "attachment-*")
+		if err != nil {
+			http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		_, err = io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(part, maxBytes+1))
+		part.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return
+		}
+		break
+	}
+
+	if tmp == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": map[string]string{"file": "File is required"},
+		})
+		return
+	}
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusInternalServerError)
+		return
+	}
+	if size > maxBytes {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// The type is sniffed from the content, the client supplied one is not trusted
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	contentType := http.DetectContentType(head[:n])
+
+	if errors := validateFilename(filename); len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+	if errors := validateContentType(contentType); len(errors) > 0 {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	sha := hex.EncodeToString(hash.Sum(nil))
+
+	// The same content attached twice to a task is returned as is
+	var existing models.Attachment
+	err = database.DB.QueryRowContext(r.Context(), `SELECT id, task_id, filename, content_type, size, sha256, uploaded_by, created_at
+		FROM attachment WHERE task_id = $1 AND sha256 = $2 LIMIT 1`, taskID, sha).Scan(
+		&existing.ID, &existing.TaskID, &existing.Filename, &existing.ContentType, &existing.Size, &existing.SHA256, &existing.UploadedBy, &existing.CreatedAt)
+	if err == nil {
+		withDownloadURL(&existing)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing)
+		return
+	} else if err != sql.ErrNoRows {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// The blob cannot be removed as an orphan between the check and the insert of the attachment
+	if err := lockBlob(r.Context(), tx, sha); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Blobs are shared between attachments, only upload content the store does not have yet
+	key := blobKey(sha)
+	exists, err := storage.Store.Exists(r.Context(), key)
+	if err != nil {
+		logging.From(r).Error("failed to store file", "error", err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Failed to read upload", http.StatusInternalServerError)
+			return
+		}
+		if err := storage.Store.Put(r.Context(), key, tmp, size, contentType); err != nil {
+			logging.From(r).Error("failed to store file", "error", err)
+			http.Error(w, "Failed to store file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	uploadedBy := r.Header.Get("Username")
+	attachment := models.Attachment{
+		TaskID:      taskID,
+		Filename:    &filename,
+		ContentType: &contentType,
+		Size:        size,
+		SHA256:      &sha,
+		UploadedBy:  &uploadedBy,
+	}
+	err = tx.QueryRowContext(r.Context(), `INSERT INTO attachment (task_id, filename, content_type, size, sha256, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		attachment.TaskID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.SHA256, attachment.UploadedBy).Scan(
+		&attachment.ID, &attachment.CreatedAt)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logging.From(r).Error("failed to create attachment", "error", err)
+		http.Error(w, "Failed to create attachment", http.StatusInternalServerError)
+		return
+	}
+
+	withDownloadURL(&attachment)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+func GetTaskAttachmentsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(), `SELECT id, task_id, filename, content_type, size, sha256, uploaded_by, created_at
+		FROM attachment WHERE task_id = $1 ORDER BY created_at, id`, taskID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve attachments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.TaskID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.UploadedBy, &a.CreatedAt); err != nil {
+			http.Error(w, "Failed to scan attachment", http.StatusInternalServerError)
+			return
+		}
+		withDownloadURL(&a)
+		attachments = append(attachments, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attachments": attachments,
+	})
+}
+
+func DeleteAttachmentHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	attachmentID, err := strconv.Atoi(ps.ByName("attachment_id"))
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	// The uploader and the task creator can remove an attachment
+	var uploadedBy string
+	var createdBy sql.NullString
+	err = database.DB.QueryRowContext(r.Context(), `SELECT attachment.uploaded_by, task.created_by FROM attachment
+		JOIN task ON task.id = attachment.task_id WHERE attachment.id = $1 AND attachment.task_id = $2`,
+		attachmentID, taskID).Scan(&uploadedBy, &createdBy)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	username := r.Header.Get("Username")
+	if uploadedBy != username && createdBy.Valid && createdBy.String != username {
+		http.Error(w, "Forbidden: not allowed to delete this attachment", http.StatusForbidden)
+		return
+	}
+
+	var sha string
+	err = database.DB.QueryRowContext(r.Context(), "DELETE FROM attachment WHERE id = $1 RETURNING sha256", attachmentID).Scan(&sha)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := deleteOrphanBlobs(r.Context(), []string{sha}); err != nil {
+		logging.From(r).Error("orphan blob cleanup failed", "error", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DownloadAttachmentHandler serves a blob to holders of a signed URL, no token is needed
+func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	attachmentID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if !storage.VerifyDownload(downloadResource(attachmentID), query.Get("expires"), query.Get("signature")) {
+		http.Error(w, "Forbidden: invalid or expired link", http.StatusForbidden)
+		return
+	}
+
+	var a models.Attachment
+	err = database.DB.QueryRowContext(r.Context(), "SELECT filename, content_type, size, sha256 FROM attachment WHERE id = $1", attachmentID).Scan(
+		&a.Filename, &a.ContentType, &a.Size, &a.SHA256)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	blob, err := storage.Store.Get(r.Context(), blobKey(*a.SHA256))
+	if err == storage.ErrNotFound {
+		http.Error(w, "Attachment content not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("failed to read attachment", "error", err)
+		http.Error(w, "Failed to read attachment", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", *a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": *a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	io.Copy(w, blob)
+}
+
+func withDownloadURL(a *models.Attachment) {
+	url := fmt.Sprintf("/attachments/%d?%s", a.ID, storage.SignDownload(downloadResource(a.ID), time.Now().Add(downloadURLLifetime)))
+	a.DownloadURL = &url
+}
+
+func downloadResource(attachmentID int) string {
+	return "attachment:" + strconv.Itoa(attachmentID)
+}
+
+func maxUploadBytes() int64 {
+	if max, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && max > 0 {
+		return max
+	}
+	return defaultMaxUploadBytes
+}
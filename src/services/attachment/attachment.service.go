@@ -0,0 +1,90 @@
+package attachment
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/storage"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// blobKey is the store key of a blob with the given SHA-256
+func blobKey(sha string) string {
+	return "sha256/" + sha[:2] + "/" + sha
+}
+
+// DeleteTaskAttachments removes every attachment of a task, and the blobs
+// no other attachment refers to. It is used when a task is purged.
+func DeleteTaskAttachments(ctx context.Context, taskID int) error {
+	rows, err := database.DB.QueryContext(ctx, "DELETE FROM attachment WHERE task_id = $1 RETURNING sha256", taskID)
+	if err != nil {
+		return err
+	}
+	var hashes []string
+	for rows.Next() {
+		var sha string
+		if err := rows.Scan(&sha); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes = append(hashes, sha)
+	}
+	rows.Close()
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	return deleteOrphanBlobs(ctx, hashes)
+}
+
+// deleteOrphanBlobs removes the blobs of the given hashes that are no longer referenced
+func deleteOrphanBlobs(ctx context.Context, hashes []string) error {
+	seen := make(map[string]bool)
+	var failed int
+	for _, sha := range hashes {
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		if err := deleteOrphanBlob(ctx, sha); err != nil {
+			logging.FromContext(ctx).Error("failed to delete blob", "sha256", sha, "error", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d blobs", failed)
+	}
+	return nil
+}
+
+// deleteOrphanBlob removes a blob unless an attachment refers to it. The lock keeps an
+// upload of the same content from attaching it while it is being removed.
+func deleteOrphanBlob(ctx context.Context, sha string) error {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockBlob(ctx, tx, sha); err != nil {
+		return err
+	}
+	var referenced bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM attachment WHERE sha256 = $1)", sha).Scan(&referenced); err != nil {
+		return err
+	}
+	if referenced {
+		return nil
+	}
+	if err := storage.Store.Delete(ctx, blobKey(sha)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockBlob serializes the uploads and removals of a blob until the transaction ends
+func lockBlob(ctx context.Context, tx *sql.Tx, sha string) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "attachment_blob:"+sha)
+	return err
+}
@@ -0,0 +1,40 @@
+package attachment
+
+import (
+	"mime"
+	"strings"
+)
+
+// allowedContentTypes are the sniffed MIME types accepted for upload
+var allowedContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"text/csv":        true,
+	// Office documents (docx, xlsx, ...) are zip archives
+	"application/zip": true,
+}
+
+func validateContentType(contentType string) map[string]string {
+	errors := make(map[string]string)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !allowedContentTypes[mediaType] {
+		errors["file"] = "File type " + contentType + " is not allowed"
+	}
+	return errors
+}
+
+func validateFilename(filename string) map[string]string {
+	errors := make(map[string]string)
+	if len(filename) == 0 {
+		errors["file"] = "Filename is required"
+	} else if len(filename) > 255 {
+		errors["file"] = "Filename must be at most 255 characters"
+	} else if strings.ContainsAny(filename, "/\\\x00") {
+		errors["file"] = "Filename must not contain path separators"
+	}
+	return errors
+}
@@ -0,0 +1,190 @@
+package caldav
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/helper/audit"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/lockout"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type usernameKey struct{}
+
+const (
+	// verifiedTTL is how long a verified password is taken without hashing it again. Clients
+	// send it with every request and argon2id is slow on purpose. A disabled account or a
+	// changed password is refused at once, enabling two-factor authentication within this time.
+	verifiedTTL = time.Minute
+
+	// maxVerified bounds the cache, it is emptied when full
+	maxVerified = 10000
+)
+
+var verified = newVerifiedCache()
+
+// basicAuth authenticates CalDAV clients with HTTP Basic against the user table,
+// native clients do not support bearer tokens
+func basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		message := "Unauthorized"
+		if ok && strings.HasPrefix(password, account.TokenPrefix) {
+			ok = checkToken(r, username, password)
+		} else if ok {
+			ok, message = checkPassword(r, username, password)
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="tasks", charset="UTF-8"`)
+			http.Error(w, message, http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), usernameKey{}, username)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkPassword shares the failure counters and lockouts of the login endpoint,
+// so that Basic authentication is not a way around them. Accounts with two-factor
+// authentication only accept personal access tokens, the password alone is not enough.
+// On failure it returns the message to answer with.
+func checkPassword(r *http.Request, username string, password string) (bool, string) {
+	ip := utils.ClientIP(r)
+	status := lockout.Check(r.Context(), username, ip)
+	if status.RetryAfter > 0 {
+		return false, "Unauthorized"
+	}
+
+	digest := verified.digest(username, password)
+	if verifiedAt, ok := verified.get(digest, time.Now()); ok {
+		acc, err := account.Get(r.Context(), username)
+		if err == nil && !acc.Disabled && (acc.SessionsValidAfter == nil || acc.SessionsValidAfter.Before(verifiedAt.Truncate(time.Second))) {
+			return true, ""
+		}
+		verified.forget(digest)
+	}
+	time.Sleep(status.Delay())
+
+	var hashedPassword string
+	var totpEnabledAt *time.Time
+	err := database.DB.QueryRowContext(r.Context(), "SELECT password, totp_enabled_at FROM \"user\" WHERE username = $1 AND disabled_at IS NULL",
+		username).Scan(&hashedPassword, &totpEnabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		logging.From(r).Error("caldav request failed", "error", err)
+		return false, "Unauthorized"
+	}
+
+	if !lockout.VerifyPassword(hashedPassword, password) {
+		locked, err := lockout.RecordFailure(r.Context(), username, ip)
+		if err != nil {
+			logging.From(r).Error("caldav request failed", "error", err)
+		}
+		if locked {
+			audit.Record(r.Context(), "", audit.ActionLoginLocked, username, ip, audit.Details{"source": "caldav"})
+		}
+		return false, "Unauthorized"
+	}
+	if err := lockout.Reset(r.Context(), username); err != nil {
+		logging.From(r).Error("caldav request failed", "error", err)
+	}
+
+	// Told only once the password is known to be right, so that it does not reveal which accounts use it
+	if totpEnabledAt != nil {
+		return false, "Unauthorized: two-factor authentication is enabled, use a personal access token as the password"
+	}
+	verified.add(digest, time.Now())
+	return true, ""
+}
+
+// verifiedCache remembers when credentials were last verified, by a keyed hash so that
+// the memory of the process holds nothing a password could be recovered from quickly
+type verifiedCache struct {
+	mu      sync.Mutex
+	key     []byte
+	entries map[string]time.Time
+}
+
+func newVerifiedCache() *verifiedCache {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return &verifiedCache{key: key, entries: make(map[string]time.Time)}
+}
+
+func (c *verifiedCache) digest(username string, password string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// get returns when the credentials were verified, if that was less than verifiedTTL ago
+func (c *verifiedCache) get(digest string, now time.Time) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	verifiedAt, ok := c.entries[digest]
+	if !ok || now.Sub(verifiedAt) >= verifiedTTL {
+		return time.Time{}, false
+	}
+	return verifiedAt, true
+}
+
+func (c *verifiedCache) add(digest string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxVerified {
+		c.entries = make(map[string]time.Time)
+	}
+	c.entries[digest] = now
+}
+
+func (c *verifiedCache) forget(digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, digest)
+}
+
+// checkToken accepts a personal access token of the user in place of the password,
+// reads need the tasks:read scope and anything else tasks:write
+func checkToken(r *http.Request, username string, token string) bool {
+	owner, scopes, err := account.AuthenticateToken(r.Context(), token)
+	if err != nil {
+		if err != account.ErrInvalidToken {
+			logging.From(r).Error("caldav request failed", "error", err)
+		}
+		return false
+	}
+	if owner != username {
+		return false
+	}
+
+	required := account.ScopeTasksWrite
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "PROPFIND", "REPORT":
+		required = account.ScopeTasksRead
+	}
+	if !account.HasScope(scopes, required) {
+		return false
+	}
+
+	acc, err := account.Get(r.Context(), username)
+	return err == nil && !acc.Disabled
+}
+
+func usernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	return username
+}
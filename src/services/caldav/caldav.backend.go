@@ -0,0 +1,400 @@
+package caldav
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/ical"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/services/calendar"
+	"be-golang-todo/src/services/task"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	goical "github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	gocaldav "github.com/emersion/go-webdav/caldav"
+)
+
+const (
+	// Prefix is the path the CalDAV handler is mounted on
+	Prefix = "/dav"
+
+	// calendarName is the only collection of a user, there are no projects to map to collections
+	calendarName = "tasks"
+
+	// maxResourceSize limits the size of a single uploaded task
+	maxResourceSize = 256 * 1024
+)
+
+var (
+	errNotFound = webdav.NewHTTPError(http.StatusNotFound, errors.New("calendar object not found"))
+	errModified = webdav.NewHTTPError(http.StatusPreconditionFailed, errors.New("object was modified"))
+)
+
+// backend serves the tasks created by or assigned to the authenticated user
+// as the VTODO objects of a single calendar collection
+type backend struct{}
+
+func userPath(username string) string {
+	return Prefix + "/" + url.PathEscape(username) + "/"
+}
+
+func homeSetPath(username string) string {
+	return userPath(username) + "calendars/"
+}
+
+func calendarPath(username string) string {
+	return homeSetPath(username) + calendarName + "/"
+}
+
+func (backend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	return userPath(usernameFromContext(ctx)), nil
+}
+
+func (backend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+	return homeSetPath(usernameFromContext(ctx)), nil
+}
+
+func (backend) CreateCalendar(ctx context.Context, c *gocaldav.Calendar) error {
+	return webdav.NewHTTPError(http.StatusForbidden, errors.New("creating calendars is not supported"))
+}
+
+func (backend) ListCalendars(ctx context.Context) ([]gocaldav.Calendar, error) {
+	return []gocaldav.Calendar{tasksCalendar(usernameFromContext(ctx))}, nil
+}
+
+func (backend) GetCalendar(ctx context.Context, p string) (*gocaldav.Calendar, error) {
+	username := usernameFromContext(ctx)
+	if p != calendarPath(username) {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, errors.New("calendar not found"))
+	}
+	c := tasksCalendar(username)
+	return &c, nil
+}
+
+func tasksCalendar(username string) gocaldav.Calendar {
+	return gocaldav.Calendar{
+		Path:                  calendarPath(username),
+		Name:                  "Tasks",
+		Description:           "Tasks created by or assigned to " + username,
+		MaxResourceSize:       maxResourceSize,
+		SupportedComponentSet: []string{goical.CompToDo},
+	}
+}
+
+func (backend) GetCalendarObject(ctx context.Context, p string, req *gocaldav.CalendarCompRequest) (*gocaldav.CalendarObject, error) {
+	username := usernameFromContext(ctx)
+	name, ok := objectName(username, p)
+	if !ok {
+		return nil, errNotFound
+	}
+
+	tasks, err := loadTasks(ctx, username, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, errNotFound
+	}
+	return tasks[0].object(username)
+}
+
+func (backend) ListCalendarObjects(ctx context.Context, p string, req *gocaldav.CalendarCompRequest) ([]gocaldav.CalendarObject, error) {
+	username := usernameFromContext(ctx)
+	if p != calendarPath(username) {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, errors.New("calendar not found"))
+	}
+
+	tasks, err := loadTasks(ctx, username, "")
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]gocaldav.CalendarObject, 0, len(tasks))
+	for _, t := range tasks {
+		object, err := t.object(username)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *object)
+	}
+	return objects, nil
+}
+
+// QueryCalendarObjects filters in memory, the collection is never larger than the user's task list
+func (b backend) QueryCalendarObjects(ctx context.Context, p string, query *gocaldav.CalendarQuery) ([]gocaldav.CalendarObject, error) {
+	objects, err := b.ListCalendarObjects(ctx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gocaldav.Filter(query, objects)
+}
+
+// PutCalendarObject creates a task or updates an existing one. Owners update every
+// synced field, assignees only the status, the rest of their changes is ignored.
+func (backend) PutCalendarObject(ctx context.Context, p string, cal *goical.Calendar, opts *gocaldav.PutCalendarObjectOptions) (*gocaldav.CalendarObject, error) {
+	username := usernameFromContext(ctx)
+	name, ok := objectName(username, p)
+	if !ok {
+		return nil, webdav.NewHTTPError(http.StatusForbidden, errors.New("objects can only be stored in the tasks calendar"))
+	}
+
+	compType, uid, err := gocaldav.ValidateCalendarObject(cal)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if compType != goical.CompToDo {
+		return nil, webdav.NewHTTPError(http.StatusForbidden, errors.New("only VTODO objects are supported"))
+	}
+
+	incoming, err := taskFromCalendar(cal)
+	if err != nil {
+		return nil, webdav.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if strings.TrimSpace(incoming.Title) == "" {
+		return nil, webdav.NewHTTPError(http.StatusBadRequest, errors.New("SUMMARY is required"))
+	}
+
+	existing, err := loadTasks(ctx, username, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(existing) == 0 {
+		if opts.IfMatch.IsSet() {
+			return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, errors.New("object does not exist"))
+		}
+		if err := createTask(ctx, username, name, uid, incoming); err != nil {
+			logging.FromContext(ctx).Error("caldav request failed", "error", err)
+			return nil, err
+		}
+	} else {
+		current := existing[0]
+		if opts.IfNoneMatch.IsWildcard() {
+			return nil, webdav.NewHTTPError(http.StatusPreconditionFailed, errors.New("object already exists"))
+		}
+		// The version is checked again by the UPDATE, the task may change in between
+		version := 0
+		if opts.IfMatch.IsSet() && !opts.IfMatch.IsWildcard() {
+			if etag, err := opts.IfMatch.ETag(); err != nil || etag != current.etag() {
+				return nil, errModified
+			}
+			version = current.Version
+		}
+		if err := updateTask(ctx, username, current.ID, version, incoming); err != nil {
+			return nil, err
+		}
+	}
+
+	tasks, err := loadTasks(ctx, username, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, errNotFound
+	}
+	return tasks[0].object(username)
+}
+
+// DeleteCalendarObject soft deletes the task, like the REST API only its owner may do so
+func (backend) DeleteCalendarObject(ctx context.Context, p string) error {
+	username := usernameFromContext(ctx)
+	name, ok := objectName(username, p)
+	if !ok {
+		return errNotFound
+	}
+
+	tasks, err := loadTasks(ctx, username, name)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return errNotFound
+	}
+
+	access, err := task.AccessFor(ctx, tasks[0].ID, username)
+	if err == task.ErrTaskNotFound {
+		return errNotFound
+	} else if err != nil {
+		logging.FromContext(ctx).Error("caldav request failed", "error", err)
+		return err
+	}
+	if access < task.AccessOwner {
+		return webdav.NewHTTPError(http.StatusForbidden, errors.New("only the owner can delete a task"))
+	}
+
+	_, err = database.DB.ExecContext(ctx, "UPDATE task SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", time.Now(), tasks[0].ID)
+	if err != nil {
+		logging.FromContext(ctx).Error("caldav request failed", "error", err)
+	}
+	return err
+}
+
+// objectName returns the resource name of a path inside the user's calendar
+func objectName(username string, p string) (string, bool) {
+	dir, name := path.Split(p)
+	if dir != calendarPath(username) || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+type davTask struct {
+	calendar.Task
+	Name    string
+	ModTime time.Time
+	Version int
+}
+
+// etag is the same entity tag as the one of the REST API
+func (t davTask) etag() string {
+	return strconv.Itoa(t.Version)
+}
+
+func (t davTask) object(username string) (*gocaldav.CalendarObject, error) {
+	root := ical.NewComponent("VCALENDAR")
+	root.Add("VERSION", "2.0")
+	root.Add("PRODID", "-//be-golang-todo//Tasks//EN")
+	root.Components = append(root.Components, calendar.TaskComponent(t.Task, false, t.ModTime))
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, root); err != nil {
+		return nil, err
+	}
+	size := int64(buf.Len())
+
+	data, err := goical.NewDecoder(&buf).Decode()
+	if err != nil {
+		return nil, err
+	}
+	return &gocaldav.CalendarObject{
+		Path:          calendarPath(username) + t.Name,
+		ModTime:       t.ModTime,
+		ContentLength: size,
+		ETag:          t.etag(),
+		Data:          data,
+	}, nil
+}
+
+// taskFromCalendar converts the uploaded calendar with the same mapping as the .ics import
+func taskFromCalendar(cal *goical.Calendar) (calendar.Task, error) {
+	var buf bytes.Buffer
+	if err := goical.NewEncoder(&buf).Encode(cal); err != nil {
+		return calendar.Task{}, err
+	}
+	root, err := ical.Decode(&buf)
+	if err != nil {
+		return calendar.Task{}, err
+	}
+	for _, c := range root.Components {
+		if c.Name == "VTODO" {
+			return calendar.TaskFromComponent(c)
+		}
+	}
+	return calendar.Task{}, errors.New("no VTODO found")
+}
+
+// loadTasks returns the live tasks created by or assigned to the user, only the one
+// with the given resource name when name is not empty. Tasks created outside of CalDAV
+// are named after their id.
+func loadTasks(ctx context.Context, username string, name string) ([]davTask, error) {
+	query := `SELECT id, COALESCE(ical_uid, ''), COALESCE(caldav_name, 'task-' || id || '.ics'), COALESCE(title, ''),
+		COALESCE(description, ''), COALESCE(status, 'pending'), COALESCE(priority, 'P2'), due_date, due_all_day, created_at,
+		COALESCE(updated_at, created_at, to_timestamp(0)), version
+		FROM task t WHERE deleted_at IS NULL
+		AND (created_by = $1 OR EXISTS (SELECT 1 FROM task_assignee a WHERE a.task_id = t.id AND a.username = $1))`
+	args := []interface{}{username}
+	if name != "" {
+		query += ` AND COALESCE(caldav_name, 'task-' || id || '.ics') = $2`
+		args = append(args, name)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.FromContext(ctx).Error("caldav request failed", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []davTask
+	for rows.Next() {
+		var t davTask
+		if err := rows.Scan(&t.ID, &t.UID, &t.Name, &t.Title, &t.Description, &t.Status, &t.Priority,
+			&t.DueDate, &t.DueAllDay, &t.CreatedAt, &t.ModTime, &t.Version); err != nil {
+			logging.FromContext(ctx).Error("caldav request failed", "error", err)
+			return nil, err
+		}
+		if t.ModTime.Unix() > 0 {
+			modTime := t.ModTime
+			t.UpdatedAt = &modTime
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// createTask creates the task of a new resource. Resource names are unique per user,
+// of two concurrent PUTs creating the same resource the second one fails with 412.
+func createTask(ctx context.Context, username string, name string, uid string, t calendar.Task) error {
+	position, err := task.NextPositionInColumn(ctx, t.Status)
+	if err != nil {
+		return err
+	}
+
+	res, err := database.DB.ExecContext(ctx, `INSERT INTO task (title, description, status, priority, position, due_date, due_all_day, created_at, created_by, ical_uid, caldav_name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (created_by, caldav_name) WHERE caldav_name IS NOT NULL AND deleted_at IS NULL DO NOTHING`,
+		t.Title, t.Description, t.Status, t.Priority, position, t.DueDate, t.DueAllDay, time.Now(), username, uid, name)
+	if err != nil {
+		return err
+	}
+	if inserted, err := res.RowsAffected(); err != nil || inserted == 0 {
+		return webdav.NewHTTPError(http.StatusPreconditionFailed, errors.New("object was created concurrently"))
+	}
+	return nil
+}
+
+// updateTask writes a resource to its task. With a version other than 0 the write only
+// happens if the task is still at that version, like a REST write with If-Match.
+func updateTask(ctx context.Context, username string, id int, version int, t calendar.Task) error {
+	access, err := task.AccessFor(ctx, id, username)
+	if err == task.ErrTaskNotFound {
+		return errNotFound
+	} else if err != nil {
+		logging.FromContext(ctx).Error("caldav request failed", "error", err)
+		return err
+	}
+
+	var res sql.Result
+	switch access {
+	case task.AccessOwner:
+		res, err = database.DB.ExecContext(ctx, `UPDATE task SET title = $1, description = $2, status = $3, priority = $4, due_date = $5,
+			due_all_day = $6, updated_at = $7, updated_by = $8 WHERE id = $9 AND deleted_at IS NULL AND ($10 = 0 OR version = $10)`,
+			t.Title, t.Description, t.Status, t.Priority, t.DueDate, t.DueAllDay, time.Now(), username, id, version)
+	case task.AccessAssignee:
+		res, err = database.DB.ExecContext(ctx, `UPDATE task SET status = $1, updated_at = $2, updated_by = $3
+			WHERE id = $4 AND deleted_at IS NULL AND ($5 = 0 OR version = $5)`,
+			t.Status, time.Now(), username, id, version)
+	default:
+		return webdav.NewHTTPError(http.StatusForbidden, errors.New("no access to this task"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("caldav request failed", "error", err)
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err == nil && rowsAffected == 0 && version != 0 {
+		return errModified
+	} else if err != nil || rowsAffected == 0 {
+		return errNotFound
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package caldav
+
+import (
+	"net/http"
+
+	gocaldav "github.com/emersion/go-webdav/caldav"
+)
+
+// Methods are the HTTP methods CalDAV clients use, to be routed to Handler
+var Methods = []string{"OPTIONS", "GET", "HEAD", "PUT", "DELETE", "PROPFIND", "PROPPATCH", "REPORT", "MKCOL", "MKCALENDAR"}
+
+// Handler serves the CalDAV tree under Prefix and the /.well-known/caldav redirect
+func Handler() http.Handler {
+	return basicAuth(&gocaldav.Handler{Backend: backend{}, Prefix: Prefix})
+}
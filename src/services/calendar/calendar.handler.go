@@ -0,0 +1,113 @@
+package calendar
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/ical"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/utils"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RegenerateCalendarTokenHandler issues a new feed token, invalidating the previous feed URL.
+// Only the hash is stored, so the token is shown once.
+func RegenerateCalendarTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	token, err := utils.RandomToken(24)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := database.DB.ExecContext(r.Context(), "UPDATE \"user\" SET calendar_token_hash = $1 WHERE username = $2", utils.HashToken(token), r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := res.RowsAffected(); err != nil || rowsAffected == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"token": token,
+		"url":   "/calendar/" + token + ".ics",
+	})
+}
+
+// RevokeCalendarTokenHandler disables the calendar feed
+func RevokeCalendarTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	_, err := database.DB.ExecContext(r.Context(), "UPDATE \"user\" SET calendar_token_hash = NULL WHERE username = $1", r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CalendarFeedHandler serves the tasks with a due date that are created by or assigned to
+// the owner of the token. The token in the URL is the only credential.
+// Tasks are VTODO entries by default, ?component=vevent renders them as VEVENT.
+func CalendarFeedHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	token := strings.TrimSuffix(ps.ByName("token"), ".ics")
+	asEvents := strings.EqualFold(r.URL.Query().Get("component"), "vevent")
+
+	var username string
+	err := database.DB.QueryRowContext(r.Context(), "SELECT username FROM \"user\" WHERE calendar_token_hash = $1 AND disabled_at IS NULL", utils.HashToken(token)).Scan(&username)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(), `SELECT id, COALESCE(ical_uid, ''), COALESCE(title, ''), COALESCE(description, ''), COALESCE(status, 'pending'), COALESCE(priority, 'P2'),
+		due_date, due_all_day, created_at, COALESCE(updated_at, created_at) FROM task
+		WHERE deleted_at IS NULL AND due_date IS NOT NULL
+		AND (created_by = $1 OR id IN (SELECT task_id FROM task_assignee WHERE username = $1))
+		ORDER BY due_date, id`, username)
+	if err != nil {
+		logging.From(r).Error("failed to retrieve tasks", "error", err)
+		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	cal := ical.NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", "-//be-golang-todo//Tasks//EN")
+	cal.Add("CALSCALE", "GREGORIAN")
+	cal.AddText("X-WR-CALNAME", "Tasks of "+username)
+
+	now := time.Now()
+	for rows.Next() {
+		var t Task
+		if err := rows.Scan(&t.ID, &t.UID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.DueDate, &t.DueAllDay, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			logging.From(r).Error("failed to scan task", "error", err)
+			http.Error(w, "Failed to scan task", http.StatusInternalServerError)
+			return
+		}
+		cal.Components = append(cal.Components, TaskComponent(t, asEvents, now))
+	}
+	if err := rows.Err(); err != nil {
+		logging.From(r).Error("failed to retrieve tasks", "error", err)
+		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	ical.Encode(w, cal)
+}
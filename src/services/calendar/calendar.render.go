@@ -0,0 +1,177 @@
+package calendar
+
+import (
+	"be-golang-todo/src/helper/ical"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// eventDuration is the length of the VEVENT rendered for a due date with a time
+const eventDuration = 30 * time.Minute
+
+// Task is the part of a task that is exchanged with calendar clients
+type Task struct {
+	ID          int
+	UID         string
+	Title       string
+	Description string
+	Status      string
+	Priority    string
+	DueDate     *time.Time
+	DueAllDay   bool
+	CreatedAt   *time.Time
+	UpdatedAt   *time.Time
+}
+
+// TaskComponent renders a task as a VTODO, or as a VEVENT for clients that only show events.
+// Due dates are stored in UTC and written in the UTC "Z" form, those of a whole day are
+// written as a DATE value.
+func TaskComponent(t Task, asEvent bool, now time.Time) *ical.Component {
+	name := "VTODO"
+	if asEvent {
+		name = "VEVENT"
+	}
+	c := ical.NewComponent(name)
+	uid := t.UID
+	if uid == "" {
+		uid = "task-" + strconv.Itoa(t.ID) + "@be-golang-todo"
+	}
+	c.Add("UID", uid)
+	c.Add("DTSTAMP", ical.FormatUTC(now))
+	if t.CreatedAt != nil {
+		c.Add("CREATED", ical.FormatUTC(*t.CreatedAt))
+	}
+	if t.UpdatedAt != nil {
+		c.Add("LAST-MODIFIED", ical.FormatUTC(*t.UpdatedAt))
+	}
+	c.AddText("SUMMARY", t.Title)
+	if t.Description != "" {
+		c.AddText("DESCRIPTION", t.Description)
+	}
+	c.Add("PRIORITY", strconv.Itoa(ICalPriority(t.Priority)))
+
+	if t.DueDate == nil {
+		if !asEvent {
+			c.Add("STATUS", ICalStatus(t.Status))
+		}
+		return c
+	}
+	due := t.DueDate.UTC()
+	allDay := t.DueAllDay
+
+	if asEvent {
+		if allDay {
+			c.Properties = append(c.Properties,
+				ical.Property{Name: "DTSTART", Params: map[string]string{"VALUE": "DATE"}, Value: ical.FormatDate(due)},
+				ical.Property{Name: "DTEND", Params: map[string]string{"VALUE": "DATE"}, Value: ical.FormatDate(due.AddDate(0, 0, 1))})
+		} else {
+			c.Add("DTSTART", ical.FormatUTC(due))
+			c.Add("DTEND", ical.FormatUTC(due.Add(eventDuration)))
+		}
+		return c
+	}
+
+	if allDay {
+		c.Properties = append(c.Properties, ical.Property{Name: "DUE", Params: map[string]string{"VALUE": "DATE"}, Value: ical.FormatDate(due)})
+	} else {
+		c.Add("DUE", ical.FormatUTC(due))
+	}
+	c.Add("STATUS", ICalStatus(t.Status))
+	if ICalStatus(t.Status) == "COMPLETED" && t.UpdatedAt != nil {
+		c.Add("COMPLETED", ical.FormatUTC(*t.UpdatedAt))
+	}
+	return c
+}
+
+// ICalPriority maps P0..P4 to the 1 (highest) .. 9 (lowest) scale of RFC 5545
+func ICalPriority(priority string) int {
+	switch priority {
+	case "P0":
+		return 1
+	case "P1":
+		return 3
+	case "P2":
+		return 5
+	case "P3":
+		return 7
+	case "P4":
+		return 9
+	}
+	return 0
+}
+
+// TaskPriority maps an RFC 5545 priority to P0..P4, 0 (undefined) is the default P2
+func TaskPriority(priority int) string {
+	switch {
+	case priority >= 1 && priority <= 2:
+		return "P0"
+	case priority >= 3 && priority <= 4:
+		return "P1"
+	case priority == 5 || priority == 0:
+		return "P2"
+	case priority >= 6 && priority <= 7:
+		return "P3"
+	}
+	return "P4"
+}
+
+// ICalStatus maps a task status to a VTODO STATUS
+func ICalStatus(status string) string {
+	switch status {
+	case "done", "completed":
+		return "COMPLETED"
+	case "in_progress":
+		return "IN-PROCESS"
+	case "cancelled":
+		return "CANCELLED"
+	}
+	return "NEEDS-ACTION"
+}
+
+// TaskFromComponent reads a VTODO or VEVENT. The due date is DUE, or DTSTART for events.
+func TaskFromComponent(c *ical.Component) (Task, error) {
+	t := Task{
+		UID:         c.Text("UID"),
+		Title:       c.Text("SUMMARY"),
+		Description: c.Text("DESCRIPTION"),
+		Status:      TaskStatus(c.Text("STATUS")),
+		Priority:    "P2",
+	}
+	if c.Name != "VTODO" && c.Name != "VEVENT" {
+		return t, errors.New("not a VTODO or VEVENT")
+	}
+
+	if p := c.Get("PRIORITY"); p != nil {
+		if priority, err := strconv.Atoi(p.Value); err == nil {
+			t.Priority = TaskPriority(priority)
+		}
+	}
+
+	due := c.Get("DUE")
+	if due == nil {
+		due = c.Get("DTSTART")
+	}
+	if due != nil {
+		dueDate, dateOnly, err := ical.ParseTime(due)
+		if err != nil {
+			return t, err
+		}
+		t.DueDate = &dueDate
+		t.DueAllDay = dateOnly
+	}
+	return t, nil
+}
+
+// TaskStatus maps a VTODO STATUS to a task status
+func TaskStatus(status string) string {
+	switch status {
+	case "COMPLETED":
+		return "done"
+	case "IN-PROCESS":
+		return "in_progress"
+	case "CANCELLED":
+		return "cancelled"
+	}
+	return "pending"
+}
@@ -0,0 +1,284 @@
+package comment
+
+import (
+	"be-golang-todo/models"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/utils"
+	"be-golang-todo/src/services/notification"
+	"be-golang-todo/src/services/task"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func GetTaskCommentsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(), `SELECT id, task_id, parent_id, author, body, created_at, updated_at, deleted_at
+		FROM comment WHERE task_id = $1 ORDER BY created_at, id`, taskID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve comments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var c models.Comment
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.ParentID, &c.Author, &c.Body, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt); err != nil {
+			http.Error(w, "Failed to scan comment", http.StatusInternalServerError)
+			return
+		}
+		if c.DeletedAt != nil {
+			c.Body = nil
+		} else if err := renderComment(&c); err != nil {
+			http.Error(w, "Failed to render comment", http.StatusInternalServerError)
+			return
+		}
+		comments = append(comments, &c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments": buildThreads(comments),
+	})
+}
+
+func CreateCommentHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.Comment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateCommentRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	// Replies must belong to a live comment of the same task
+	if req.ParentID != nil {
+		var parentExists bool
+		err := database.DB.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM comment WHERE id = $1 AND task_id = $2 AND deleted_at IS NULL)",
+			*req.ParentID, taskID).Scan(&parentExists)
+		if err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if !parentExists {
+			http.Error(w, "Parent comment not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	author := r.Header.Get("Username")
+	req.TaskID = taskID
+	req.Author = &author
+
+	err = database.DB.QueryRowContext(r.Context(), "INSERT INTO comment (task_id, parent_id, author, body) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		req.TaskID, req.ParentID, req.Author, req.Body).Scan(&req.ID, &req.CreatedAt)
+	if err != nil {
+		logging.From(r).Error("failed to create comment", "error", err)
+		http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
+
+	if err := notification.NotifyMentions(r.Context(), author, taskID, *req.Body, ""); err != nil {
+		logging.From(r).Error("mention notification failed", "error", err)
+	}
+
+	if err := renderComment(&req); err != nil {
+		http.Error(w, "Failed to render comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(req)
+}
+
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, commentID, ok := parseCommentParams(w, ps)
+	if !ok {
+		return
+	}
+
+	var req models.Comment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateCommentRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	author := r.Header.Get("Username")
+	previous, ok := authoredComment(w, r, taskID, commentID, author)
+	if !ok {
+		return
+	}
+
+	var updated models.Comment
+	err := database.DB.QueryRowContext(r.Context(), `UPDATE comment SET body = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL
+		RETURNING id, task_id, parent_id, author, body, created_at, updated_at`, req.Body, time.Now(), commentID).Scan(
+		&updated.ID, &updated.TaskID, &updated.ParentID, &updated.Author, &updated.Body, &updated.CreatedAt, &updated.UpdatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := notification.NotifyMentions(r.Context(), author, taskID, *updated.Body, *previous.Body); err != nil {
+		logging.From(r).Error("mention notification failed", "error", err)
+	}
+
+	if err := renderComment(&updated); err != nil {
+		http.Error(w, "Failed to render comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, commentID, ok := parseCommentParams(w, ps)
+	if !ok {
+		return
+	}
+
+	if _, ok := authoredComment(w, r, taskID, commentID, r.Header.Get("Username")); !ok {
+		return
+	}
+
+	// Soft delete so that replies keep their place in the thread
+	res, err := database.DB.ExecContext(r.Context(), "UPDATE comment SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", time.Now(), commentID)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Comment not found or already deleted", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseCommentParams(w http.ResponseWriter, ps httprouter.Params) (int, int, bool) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	commentID, err := strconv.Atoi(ps.ByName("comment_id"))
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return taskID, commentID, true
+}
+
+// authoredComment loads a live comment and checks that it was written by the given user
+func authoredComment(w http.ResponseWriter, r *http.Request, taskID int, commentID int, username string) (models.Comment, bool) {
+	var c models.Comment
+	err := database.DB.QueryRowContext(r.Context(), "SELECT id, author, body FROM comment WHERE id = $1 AND task_id = $2 AND deleted_at IS NULL",
+		commentID, taskID).Scan(&c.ID, &c.Author, &c.Body)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return c, false
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return c, false
+	}
+
+	if *c.Author != username {
+		http.Error(w, "Forbidden: only the author can change this comment", http.StatusForbidden)
+		return c, false
+	}
+	return c, true
+}
+
+func renderComment(c *models.Comment) error {
+	html, err := utils.RenderMarkdown(*c.Body)
+	if err != nil {
+		return err
+	}
+	c.BodyHTML = &html
+	return nil
+}
+
+// buildThreads nests replies under their parents. Deleted comments are kept
+// as empty placeholders while they still have replies, and dropped otherwise.
+func buildThreads(comments []*models.Comment) []*models.Comment {
+	byID := make(map[int]*models.Comment)
+	for _, c := range comments {
+		byID[c.ID] = c
+	}
+
+	roots := []*models.Comment{}
+	for _, c := range comments {
+		if c.ParentID != nil {
+			if parent, ok := byID[*c.ParentID]; ok {
+				parent.Replies = append(parent.Replies, c)
+				continue
+			}
+		}
+		roots = append(roots, c)
+	}
+	return pruneDeleted(roots)
+}
+
+func pruneDeleted(comments []*models.Comment) []*models.Comment {
+	kept := []*models.Comment{}
+	for _, c := range comments {
+		c.Replies = pruneDeleted(c.Replies)
+		if c.DeletedAt == nil || len(c.Replies) > 0 {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,16 @@
+package comment
+
+import (
+	"be-golang-todo/models"
+)
+
+// validateCommentRequest checks the body of a new or edited comment
+func validateCommentRequest(req models.Comment) map[string]string {
+	errors := make(map[string]string)
+	if req.Body == nil || len(*req.Body) == 0 {
+		errors["body"] = "Body is required"
+	} else if len(*req.Body) > 10000 {
+		errors["body"] = "Body must be at most 10000 characters"
+	}
+	return errors
+}
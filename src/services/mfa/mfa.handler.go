@@ -0,0 +1,387 @@
+package mfa
+
+import (
+	"be-golang-todo/src/helper/audit"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/lockout"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/session"
+	"be-golang-todo/src/helper/twofactor"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+type loginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// GetMFAStatusHandler tells whether two-factor authentication is on and how many recovery codes are left
+func GetMFAStatusHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	username := r.Header.Get("Username")
+
+	var enabledAt *time.Time
+	var recoveryCodesLeft int
+	err := database.DB.QueryRowContext(r.Context(), `SELECT totp_enabled_at,
+		(SELECT COUNT(*) FROM mfa_recovery_code WHERE username = $1 AND used_at IS NULL)
+		FROM "user" WHERE username = $1`, username).Scan(&enabledAt, &recoveryCodesLeft)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"totp_enabled":        enabledAt != nil,
+		"totp_enabled_at":     enabledAt,
+		"recovery_codes_left": recoveryCodesLeft,
+	})
+}
+
+// EnrollTOTPHandler starts the enrollment with a new secret. It is only enabled once
+// a code generated from it is confirmed with VerifyTOTPHandler.
+func EnrollTOTPHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	username := r.Header.Get("Username")
+
+	_, enabled, err := loadTOTP(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	key, err := twofactor.NewKey(username)
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	sealed, err := twofactor.EncryptSecret(key.Secret())
+	if err != nil {
+		logging.From(r).Error("failed to store secret", "error", err)
+		http.Error(w, "Failed to store secret", http.StatusInternalServerError)
+		return
+	}
+	qr, err := provisioningQR(key)
+	if err != nil {
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = database.DB.ExecContext(r.Context(), `UPDATE "user" SET totp_secret = $1, totp_enabled_at = NULL, totp_last_step = NULL WHERE username = $2`,
+		sealed, username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           key.Secret(),
+		"provisioning_uri": key.URL(),
+		"qr_png":           qr,
+	})
+}
+
+// VerifyTOTPHandler enables two-factor authentication with the first code of the enrolled
+// secret and returns the recovery codes, which are not shown again
+func VerifyTOTPHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req codeRequest
+	if !decodeCodeRequest(w, r, &req) {
+		return
+	}
+
+	username := r.Header.Get("Username")
+	secret, enabled, err := loadTOTP(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if secret == "" {
+		http.Error(w, "No enrollment in progress", http.StatusNotFound)
+		return
+	}
+
+	ok, err := verifyTOTP(r.Context(), username, secret, req.Code)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnprocessableEntity)
+		return
+	}
+
+	codes, err := newRecoveryCodes(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := database.DB.ExecContext(r.Context(), `UPDATE "user" SET totp_enabled_at = $1 WHERE username = $2`, time.Now(), username); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r.Context(), username, audit.ActionMFAEnabled, username, utils.ClientIP(r), nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTPHandler turns two-factor authentication off, with a current code or a recovery code
+func DisableTOTPHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req codeRequest
+	if !decodeCodeRequest(w, r, &req) {
+		return
+	}
+
+	username := r.Header.Get("Username")
+	if !checkEnabledCode(w, r, username, req.Code, true) {
+		return
+	}
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(r.Context(), `UPDATE "user" SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE username = $1`, username)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "DELETE FROM mfa_recovery_code WHERE username = $1", username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r.Context(), username, audit.ActionMFADisabled, username, utils.ClientIP(r), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodesHandler replaces all recovery codes, it takes a TOTP code
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req codeRequest
+	if !decodeCodeRequest(w, r, &req) {
+		return
+	}
+
+	username := r.Header.Get("Username")
+	if !checkEnabledCode(w, r, username, req.Code, false) {
+		return
+	}
+
+	codes, err := newRecoveryCodes(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// LoginMFAHandler is the second step of a login with two-factor authentication.
+// It exchanges the MFA token returned by /login and a TOTP or recovery code for a JWT.
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateLoginRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	username, tokenID, err := utils.DecodeMFAToken(req.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	status := lockout.Check(r.Context(), username, ip)
+	if status.RetryAfter > 0 {
+		w.Header().Set("Retry-After", lockout.RetryAfterSeconds(status.RetryAfter))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	ok, err := twofactor.TakeLoginAttempt(r.Context(), tokenID)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	var role string
+	var sealed sql.NullString
+	var disabledAt, enabledAt *time.Time
+	err = database.DB.QueryRowContext(r.Context(), `SELECT role, disabled_at, totp_secret, totp_enabled_at FROM "user" WHERE username = $1`, username).Scan(
+		&role, &disabledAt, &sealed, &enabledAt)
+	if err == sql.ErrNoRows || (err == nil && (disabledAt != nil || enabledAt == nil)) {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	valid := false
+	usedRecoveryCode := twofactor.IsRecoveryCode(req.Code)
+	if usedRecoveryCode {
+		valid, err = useRecoveryCode(r.Context(), username, req.Code)
+	} else {
+		var secret string
+		if secret, err = twofactor.DecryptSecret(sealed.String); err == nil {
+			valid, err = verifyTOTP(r.Context(), username, secret, req.Code)
+		}
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		locked, err := lockout.RecordFailure(r.Context(), username, ip)
+		if err != nil {
+			logging.From(r).Error("login failure not recorded", "error", err)
+		}
+		if locked {
+			audit.Record(r.Context(), "", audit.ActionLoginLocked, username, ip, audit.Details{"source": "mfa"})
+		}
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := twofactor.FinishLogin(r.Context(), tokenID); err != nil {
+		logging.From(r).Error("two-factor login not finished", "error", err)
+	}
+	if err := lockout.Reset(r.Context(), username); err != nil {
+		logging.From(r).Error("login failure reset failed", "error", err)
+	}
+	if usedRecoveryCode {
+		audit.Record(r.Context(), username, audit.ActionRecoveryUsed, username, ip, nil)
+	}
+
+	token, err := session.Issue(r, username, role)
+	if err != nil {
+		http.Error(w, "Failed to generate JWT", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Login successful",
+		"token":   token,
+		"decode":  username,
+	})
+}
+
+// loadTOTP returns the decrypted secret of a user, "" when there is none, and whether it is enabled
+func loadTOTP(ctx context.Context, username string) (string, bool, error) {
+	var sealed sql.NullString
+	var enabledAt *time.Time
+	err := database.DB.QueryRowContext(ctx, `SELECT totp_secret, totp_enabled_at FROM "user" WHERE username = $1`, username).Scan(&sealed, &enabledAt)
+	if err != nil || !sealed.Valid {
+		return "", false, err
+	}
+	secret, err := twofactor.DecryptSecret(sealed.String)
+	return secret, enabledAt != nil, err
+}
+
+// checkEnabledCode writes the error response and returns false unless two-factor
+// authentication is enabled and the code is valid
+func checkEnabledCode(w http.ResponseWriter, r *http.Request, username string, code string, allowRecoveryCode bool) bool {
+	secret, enabled, err := loadTOTP(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if !enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return false
+	}
+
+	var ok bool
+	if allowRecoveryCode && twofactor.IsRecoveryCode(code) {
+		ok, err = useRecoveryCode(r.Context(), username, code)
+	} else {
+		ok, err = verifyTOTP(r.Context(), username, secret, code)
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
+
+func decodeCodeRequest(w http.ResponseWriter, r *http.Request, req *codeRequest) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+
+	// Validate the request data
+	errors := validateCodeRequest(*req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package mfa
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/twofactor"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+)
+
+// verifyTOTP checks a code against the secret of a user and records its time step,
+// a code of a step that was already used is rejected so that it cannot be replayed
+func verifyTOTP(ctx context.Context, username string, secret string, code string) (bool, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The row stays locked until the step is recorded, so a code is accepted only once
+	var lastStep sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT totp_last_step FROM "user" WHERE username = $1 FOR UPDATE`, username).Scan(&lastStep); err != nil {
+		return false, err
+	}
+	after := int64(-1)
+	if lastStep.Valid {
+		after = lastStep.Int64
+	}
+	step := twofactor.MatchingStep(secret, code, time.Now(), after)
+	if step < 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE "user" SET totp_last_step = $1 WHERE username = $2`, step, username); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// newRecoveryCodes replaces the recovery codes of a user and returns them, they are only stored hashed
+func newRecoveryCodes(ctx context.Context, username string) ([]string, error) {
+	codes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_code WHERE username = $1", username); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_code (username, code_hash) VALUES ($1, $2)",
+			username, utils.HashToken(twofactor.NormalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, tx.Commit()
+}
+
+// useRecoveryCode consumes an unused recovery code of a user
+func useRecoveryCode(ctx context.Context, username string, code string) (bool, error) {
+	res, err := database.DB.ExecContext(ctx, `UPDATE mfa_recovery_code SET used_at = $1
+		WHERE username = $2 AND code_hash = $3 AND used_at IS NULL`, time.Now(), username, utils.HashToken(twofactor.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+// StartLogin issues the token a user with two-factor authentication exchanges for a session
+// at /login/mfa. Each token allows a few attempts and is gone once used.
+func StartLogin(ctx context.Context, username string) (string, error) {
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	if err := twofactor.StartLoginAttempts(ctx, id); err != nil {
+		return "", err
+	}
+	return utils.GenerateMFAToken(username, id)
+}
+
+// provisioningQR renders the otpauth URI of a key as a PNG data URI
+func provisioningQR(key *otp.Key) (string, error) {
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	encoder := base64.NewEncoder(base64.StdEncoding, &buf)
+	if err := png.Encode(encoder, img); err != nil {
+		return "", err
+	}
+	encoder.Close()
+	return "data:image/png;base64," + buf.String(), nil
+}
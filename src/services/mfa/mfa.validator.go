@@ -0,0 +1,20 @@
+package mfa
+
+func validateCodeRequest(req codeRequest) map[string]string {
+	errors := make(map[string]string)
+	if len(req.Code) == 0 {
+		errors["code"] = "Code is required"
+	}
+	return errors
+}
+
+func validateLoginRequest(req loginRequest) map[string]string {
+	errors := make(map[string]string)
+	if len(req.MFAToken) == 0 {
+		errors["mfa_token"] = "MFA token is required"
+	}
+	if len(req.Code) == 0 {
+		errors["code"] = "Code is required"
+	}
+	return errors
+}
@@ -0,0 +1,73 @@
+package notification
+
+import (
+	"be-golang-todo/models"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := "SELECT id, username, type, task_id, message, created_at, read_at FROM notification WHERE username = $1"
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $2"
+
+	rows, err := database.DB.QueryContext(r.Context(), query, r.Header.Get("Username"), limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve notifications", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.Username, &n.Type, &n.TaskID, &n.Message, &n.CreatedAt, &n.ReadAt); err != nil {
+			http.Error(w, "Failed to scan notification", http.StatusInternalServerError)
+			return
+		}
+		notifications = append(notifications, n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+	})
+}
+
+func MarkNotificationReadHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	query := `UPDATE notification SET read_at = $1 WHERE id = $2 AND username = $3 AND read_at IS NULL`
+	res, err := database.DB.ExecContext(r.Context(), query, time.Now(), id, r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Notification not found or already read", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
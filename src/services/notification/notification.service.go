@@ -0,0 +1,69 @@
+package notification
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Notification types shown in the in-app feed
+const (
+	TypeTaskAssigned = "task_assigned"
+	TypeMentioned    = "mentioned"
+)
+
+// Notify adds an entry to the notification feed of a user
+func Notify(ctx context.Context, username string, notificationType string, taskID int, message string) error {
+	_, err := database.DB.ExecContext(ctx, "INSERT INTO notification (username, type, task_id, message) VALUES ($1, $2, $3, $4)",
+		username, notificationType, taskID, message)
+	return err
+}
+
+// NotifyMentions notifies the existing users @mentioned in text by author.
+// Users already mentioned in previous are skipped, so edits only notify new mentions.
+func NotifyMentions(ctx context.Context, author string, taskID int, text string, previous string) error {
+	alreadyMentioned := make(map[string]bool)
+	for _, username := range utils.ExtractMentions(previous) {
+		alreadyMentioned[username] = true
+	}
+
+	var candidates []string
+	for _, username := range utils.ExtractMentions(text) {
+		if !alreadyMentioned[username] && username != author {
+			candidates = append(candidates, username)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Only mentions matching a registered user who has not deleted their account produce a notification
+	rows, err := database.DB.QueryContext(ctx, "SELECT username FROM \"user\" WHERE username = ANY($1) AND deleted_at IS NULL", pq.Array(candidates))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var mentioned []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return err
+		}
+		mentioned = append(mentioned, username)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("%s mentioned you on task #%d", author, taskID)
+	for _, username := range mentioned {
+		if err := Notify(ctx, username, TypeMentioned, taskID, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
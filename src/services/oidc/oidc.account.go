@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Same bounds as a username chosen at /register
+const (
+	minUsernameLength = 5
+	maxUsernameLength = 20
+)
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+type account struct {
+	Username    string
+	Role        string
+	Disabled    bool
+	TOTPEnabled bool
+	// Linked is set when the identity was just attached to an existing account
+	Linked bool
+}
+
+// resolveAccount finds the account of an identity. An unknown identity is linked to the
+// account with the same verified email address, or else gets a new account without password.
+func resolveAccount(ctx context.Context, claims Claims) (account, error) {
+	var acc account
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return acc, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, "SELECT username FROM user_identity WHERE issuer = $1 AND subject = $2",
+		claims.Issuer, claims.Subject).Scan(&acc.Username)
+	if err == sql.ErrNoRows {
+		acc.Username, acc.Linked, err = linkIdentity(ctx, tx, claims)
+	}
+	if err != nil {
+		return acc, err
+	}
+
+	var disabledAt, totpEnabledAt *time.Time
+	err = tx.QueryRowContext(ctx, `SELECT role, disabled_at, totp_enabled_at FROM "user" WHERE username = $1`, acc.Username).Scan(
+		&acc.Role, &disabledAt, &totpEnabledAt)
+	if err != nil {
+		return acc, err
+	}
+	acc.Disabled = disabledAt != nil
+	acc.TOTPEnabled = totpEnabledAt != nil
+	return acc, tx.Commit()
+}
+
+func linkIdentity(ctx context.Context, tx *sql.Tx, claims Claims) (string, bool, error) {
+	var username string
+	linked := false
+
+	// An address only counts when both sides verified it, otherwise anyone could claim an account
+	if claims.Email != "" && claims.EmailVerified {
+		err := tx.QueryRowContext(ctx, `SELECT username FROM "user" WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL`,
+			claims.Email).Scan(&username)
+		if err != nil && err != sql.ErrNoRows {
+			return "", false, err
+		}
+		linked = err == nil
+	}
+
+	if !linked {
+		var err error
+		if username, err = provisionAccount(ctx, tx, claims); err != nil {
+			return "", false, err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, "INSERT INTO user_identity (username, issuer, subject, email) VALUES ($1, $2, $3, NULLIF($4, ''))",
+		username, claims.Issuer, claims.Subject, claims.Email)
+	return username, linked, err
+}
+
+// provisionAccount creates an account named after the identity. It has no password,
+// so it can only sign in through the identity provider until one is set.
+func provisionAccount(ctx context.Context, tx *sql.Tx, claims Claims) (string, error) {
+	base := usernameBase(claims)
+	for i := 1; ; i++ {
+		username := base
+		if i > 1 {
+			suffix := strconv.Itoa(i)
+			username = base[:min(len(base), maxUsernameLength-len(suffix))] + suffix
+		}
+
+		var taken bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM "user" WHERE username = $1)`, username).Scan(&taken); err != nil {
+			return "", err
+		}
+		if taken {
+			continue
+		}
+
+		// The address is kept only when it is verified and not used by another account
+		var emailTaken bool
+		if claims.Email != "" && claims.EmailVerified {
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM "user" WHERE lower(email) = lower($1))`, claims.Email).Scan(&emailTaken); err != nil {
+				return "", err
+			}
+		}
+		var email interface{}
+		var verifiedAt interface{}
+		if claims.Email != "" && claims.EmailVerified && !emailTaken {
+			email, verifiedAt = claims.Email, time.Now()
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO "user" (username, password, email, email_verified_at) VALUES ($1, '', $2, $3)`,
+			username, email, verifiedAt)
+		return username, err
+	}
+}
+
+// usernameBase derives a valid username from the preferred username or email of an identity
+func usernameBase(claims Claims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	name = usernameInvalidChars.ReplaceAllString(strings.ToLower(name), "")
+	if len(name) > maxUsernameLength {
+		name = name[:maxUsernameLength]
+	}
+	if len(name) < minUsernameLength {
+		suffix, _ := utils.RandomToken(6)
+		suffix = usernameInvalidChars.ReplaceAllString(strings.ToLower(suffix), "")
+		name += "user" + suffix
+		name = name[:min(len(name), maxUsernameLength)]
+	}
+	return name
+}
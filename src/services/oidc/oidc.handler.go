@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"be-golang-todo/src/helper/audit"
+	"be-golang-todo/src/helper/logging"
+	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/session"
+	"be-golang-todo/src/helper/utils"
+	"be-golang-todo/src/services/mfa"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/oauth2"
+)
+
+// loginStateTTL is how long a user has to sign in at the identity provider
+const loginStateTTL = 10 * time.Minute
+
+// loginState is kept in Redis under the state parameter between the redirect and the callback
+type loginState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+}
+
+// LoginHandler redirects to the identity provider to sign in
+func LoginHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	provider, err := providerNamed(r.Context(), ps.ByName("provider"))
+	if err == ErrUnknownProvider {
+		http.Error(w, "Identity provider not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("identity provider unavailable", "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state, err := utils.RandomToken(24)
+	if err != nil {
+		http.Error(w, "Failed to generate state", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := utils.RandomToken(24)
+	if err != nil {
+		http.Error(w, "Failed to generate nonce", http.StatusInternalServerError)
+		return
+	}
+	stored := loginState{Provider: ps.ByName("provider"), CodeVerifier: oauth2.GenerateVerifier(), Nonce: nonce}
+	data, _ := json.Marshal(stored)
+	if err := config.RDB.Set(r.Context(), loginStateKey(state), data, loginStateTTL).Err(); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthURL(state, stored.Nonce, stored.CodeVerifier), http.StatusFound)
+}
+
+// CallbackHandler completes the sign in at the identity provider and issues the same JWT
+// as /login, or an MFA token when the account has two-factor authentication
+func CallbackHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, "Sign in failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	// The state is removed as it is read so that a callback cannot be replayed
+	data, err := config.RDB.GetDel(r.Context(), loginStateKey(query.Get("state"))).Bytes()
+	if err == redis.Nil || query.Get("state") == "" {
+		http.Error(w, "Invalid or expired sign in, start again", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	var state loginState
+	if err := json.Unmarshal(data, &state); err != nil || state.Provider != ps.ByName("provider") {
+		http.Error(w, "Invalid or expired sign in, start again", http.StatusBadRequest)
+		return
+	}
+
+	provider, err := providerNamed(r.Context(), state.Provider)
+	if err != nil {
+		logging.From(r).Error("identity provider unavailable", "error", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logging.From(r).Error("sign in failed", "error", err)
+		http.Error(w, "Sign in failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := resolveAccount(r.Context(), claims)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if user.Linked {
+		audit.Record(r.Context(), user.Username, audit.ActionIdentityLinked, user.Username, utils.ClientIP(r), audit.Details{"issuer": claims.Issuer})
+	}
+	if user.Disabled {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err := mfa.StartLogin(r.Context(), user.Username)
+		if err != nil {
+			logging.From(r).Error("failed to start two-factor login", "error", err)
+			http.Error(w, "Failed to start two-factor login", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
+
+	token, err := session.Issue(r, user.Username, user.Role)
+	if err != nil {
+		http.Error(w, "Failed to generate JWT", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Login successful",
+		"token":   token,
+		"decode":  user.Username,
+	})
+}
+
+func loginStateKey(state string) string {
+	return "oidc:state:" + state
+}
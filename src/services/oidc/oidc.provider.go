@@ -0,0 +1,150 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Config describes an identity provider, read from OIDC_<NAME>_* variables
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the parts of a verified ID token used to find or create the account
+type Claims struct {
+	Issuer            string `json:"iss"`
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// Provider runs the authorization code flow with PKCE against one issuer. Its endpoints
+// and signing keys come from the issuer's discovery document.
+type Provider struct {
+	config   Config
+	oauth    oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]*Provider{}
+)
+
+// NewProvider fetches the discovery document of the issuer
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	discovered, err := gooidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovery of %s: %w", cfg.Issuer, err)
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{gooidc.ScopeOpenID, "profile", "email"}
+	}
+	return &Provider{
+		config: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     discovered.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: discovered.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// AuthURL is where the user is sent to sign in
+func (p *Provider) AuthURL(state string, nonce string, codeVerifier string) string {
+	return p.oauth.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier))
+}
+
+// Exchange redeems an authorization code and verifies the signature, audience, expiry
+// and nonce of the ID token that comes with it
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (Claims, error) {
+	var claims Claims
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return claims, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return claims, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return claims, err
+	}
+	if idToken.Nonce != nonce {
+		return claims, errors.New("ID token nonce does not match")
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return claims, err
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// providerNamed returns the configured provider, discovering it on first use so that an
+// unreachable issuer does not keep the server from starting
+func providerNamed(ctx context.Context, name string) (*Provider, error) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if p, ok := providers[name]; ok {
+		return p, nil
+	}
+	cfg, ok := configFromEnv(name)
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	p, err := NewProvider(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	providers[name] = p
+	return p, nil
+}
+
+// configFromEnv reads a provider listed in OIDC_PROVIDERS
+func configFromEnv(name string) (Config, bool) {
+	listed := false
+	for _, n := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		if strings.TrimSpace(n) == name {
+			listed = true
+		}
+	}
+	if !listed || name == "" {
+		return Config{}, false
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	cfg := Config{
+		Name:         name,
+		Issuer:       os.Getenv(prefix + "ISSUER"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+	}
+	if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+		cfg.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+	}
+	return cfg, cfg.Issuer != "" && cfg.ClientID != ""
+}
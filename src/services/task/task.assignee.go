@@ -0,0 +1,280 @@
+package task
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/services/notification"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lib/pq"
+)
+
+// Access levels of a user on a task
+const (
+	AccessNone = iota
+	AccessAssignee
+	AccessOwner
+)
+
+var ErrTaskNotFound = errors.New("task not found")
+
+type assignTaskRequest struct {
+	Usernames []string `json:"usernames"`
+}
+
+func AssignTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req assignTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateAssignTaskRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	username := r.Header.Get("Username")
+	if !RequireAccess(w, r, id, username, AccessOwner) {
+		return
+	}
+
+	unknown, err := assignUsers(r.Context(), id, username, req.Usernames)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(unknown) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": map[string]string{"usernames": "Unknown users: " + strings.Join(unknown, ", ")},
+		})
+		return
+	}
+
+	assignees, err := taskAssignees(r.Context(), id)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        id,
+		"assignees": assignees,
+	})
+}
+
+func UnassignTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Owners can remove anyone, assignees can only remove themselves
+	username := r.Header.Get("Username")
+	assignee := ps.ByName("username")
+	required := AccessOwner
+	if assignee == username {
+		required = AccessAssignee
+	}
+	if !RequireAccess(w, r, id, username, required) {
+		return
+	}
+
+	res, err := database.DB.ExecContext(r.Context(), "DELETE FROM task_assignee WHERE task_id = $1 AND username = $2", id, assignee)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Assignee not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// assignUsers adds assignees to a task and notifies the newly assigned users.
+// There are no shared projects yet, so any existing user can be assigned.
+// Nothing is written when one of the usernames does not exist; those are returned instead.
+func assignUsers(ctx context.Context, taskID int, assignedBy string, usernames []string) ([]string, error) {
+	unknown, err := unknownUsers(ctx, database.DB, usernames)
+	if err != nil || len(unknown) > 0 {
+		return unknown, err
+	}
+	added, err := addAssignees(ctx, database.DB, taskID, assignedBy, usernames)
+	if err != nil {
+		return nil, err
+	}
+	notifyAssigned(ctx, taskID, assignedBy, added)
+	return nil, nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// unknownUsers returns the usernames that belong to no account, deleted ones included
+func unknownUsers(ctx context.Context, db querier, usernames []string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT username FROM \"user\" WHERE username = ANY($1) AND deleted_at IS NULL", pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		existing[username] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for _, username := range usernames {
+		if !existing[username] {
+			unknown = append(unknown, username)
+		}
+	}
+	return unknown, nil
+}
+
+// addAssignees assigns users to a task and returns those who were not assigned already
+func addAssignees(ctx context.Context, db querier, taskID int, assignedBy string, usernames []string) ([]string, error) {
+	var added []string
+	for _, username := range usernames {
+		res, err := db.ExecContext(ctx, `INSERT INTO task_assignee (task_id, username, assigned_by) VALUES ($1, $2, $3)
+			ON CONFLICT (task_id, username) DO NOTHING`, taskID, username, assignedBy)
+		if err != nil {
+			return nil, err
+		}
+		if inserted, _ := res.RowsAffected(); inserted > 0 {
+			added = append(added, username)
+		}
+	}
+	return added, nil
+}
+
+// notifyAssigned tells newly assigned users about the task, never for self-assignment
+func notifyAssigned(ctx context.Context, taskID int, assignedBy string, usernames []string) {
+	for _, username := range usernames {
+		if username == assignedBy {
+			continue
+		}
+		message := fmt.Sprintf("%s assigned you to task #%d", assignedBy, taskID)
+		if err := notification.Notify(ctx, username, notification.TypeTaskAssigned, taskID, message); err != nil {
+			logging.FromContext(ctx).Error("assignment notification failed", "error", err)
+		}
+	}
+}
+
+func taskAssignees(ctx context.Context, taskID int) ([]string, error) {
+	rows, err := database.DB.QueryContext(ctx, "SELECT username FROM task_assignee WHERE task_id = $1 ORDER BY assigned_at, username", taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignees := []string{}
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		assignees = append(assignees, username)
+	}
+	return assignees, rows.Err()
+}
+
+// ownedBy is the SQL condition for tasks of the given table, or alias, that the user in
+// placeholder argID owns. Tasks created before created_by was recorded have no owner and
+// are owned by everyone.
+func ownedBy(table string, argID int) string {
+	return fmt.Sprintf("(%[1]s.created_by IS NULL OR %[1]s.created_by = $%[2]d)", table, argID)
+}
+
+// assignedTo is the SQL condition for tasks the user in placeholder argID is assigned to
+func assignedTo(table string, argID int) string {
+	return fmt.Sprintf("%s.id IN (SELECT task_id FROM task_assignee WHERE username = $%d)", table, argID)
+}
+
+// visibleTo is the SQL condition for tasks the user in placeholder argID has any access to,
+// every query listing the tasks of a user agrees with AccessFor through it
+func visibleTo(table string, argID int) string {
+	return "(" + ownedBy(table, argID) + " OR " + assignedTo(table, argID) + ")"
+}
+
+// AccessFor returns the access level of a user on a live task
+func AccessFor(ctx context.Context, taskID int, username string) (int, error) {
+	var owned, assigned bool
+	err := database.DB.QueryRowContext(ctx, `SELECT `+ownedBy("task", 2)+`, `+assignedTo("task", 2)+`
+		FROM task WHERE id = $1 AND deleted_at IS NULL`, taskID, username).Scan(&owned, &assigned)
+	if err == sql.ErrNoRows {
+		return AccessNone, ErrTaskNotFound
+	} else if err != nil {
+		return AccessNone, err
+	}
+
+	if owned {
+		return AccessOwner, nil
+	}
+	if assigned {
+		return AccessAssignee, nil
+	}
+	return AccessNone, nil
+}
+
+// RequireAccess writes the error response and returns false when the user lacks the required
+// access to a live task. Services keeping things per task check it before reading or adding them.
+func RequireAccess(w http.ResponseWriter, r *http.Request, taskID int, username string, required int) bool {
+	access, err := AccessFor(r.Context(), taskID, username)
+	if err == ErrTaskNotFound {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	if access == AccessNone {
+		http.Error(w, "Forbidden: no access to this task", http.StatusForbidden)
+		return false
+	}
+	if access < required {
+		http.Error(w, "Forbidden: not allowed to change this task", http.StatusForbidden)
+		return false
+	}
+	return true
+}
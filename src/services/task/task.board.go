@@ -0,0 +1,238 @@
+package task
+
+import (
+	"be-golang-todo/models"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultStatus   = "pending"
+	defaultPriority = "P2"
+)
+
+// boardStatuses is the column order of the board, any other status is appended after these
+var boardStatuses = []string{"pending", "in_progress", "done"}
+
+var errInvalidNeighbor = errors.New("invalid neighbor")
+
+// moveTaskRequest places a task between two neighbors of a column.
+// Before is the task that ends up directly above the moved task and After the one directly below it.
+// Leaving both empty moves the task to the bottom of the column.
+type moveTaskRequest struct {
+	Status *string `json:"status"`
+	Before *int    `json:"before"`
+	After  *int    `json:"after"`
+}
+
+type boardColumn struct {
+	Status string        `json:"status"`
+	Tasks  []models.Task `json:"tasks"`
+}
+
+func MoveTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req moveTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateMoveTaskRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	// Both owners and assignees can move a card
+	if !RequireAccess(w, r, id, r.Header.Get("Username"), AccessAssignee) {
+		return
+	}
+
+	// The task stays in its current column unless a new status is given
+	var currentStatus string
+	err = database.DB.QueryRowContext(r.Context(), "SELECT COALESCE(status, $2) FROM task WHERE id = $1 AND deleted_at IS NULL", id, defaultStatus).Scan(&currentStatus)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	status := currentStatus
+	if req.Status != nil {
+		status = *req.Status
+	}
+
+	var position string
+	if req.Before == nil && req.After == nil {
+		position, err = NextPositionInColumn(r.Context(), status)
+	} else {
+		position, err = positionBetweenNeighbors(r.Context(), id, status, req.Before, req.After)
+	}
+	if err == errInvalidNeighbor {
+		http.Error(w, "Before and after must be other tasks of the target column, with before above after", http.StatusConflict)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the moved row is written, its neighbors keep their keys
+	query := `UPDATE task SET status = $1, position = $2, updated_at = $3, updated_by = $4 WHERE id = $5 AND deleted_at IS NULL`
+	res, err := database.DB.ExecContext(r.Context(), query, status, position, time.Now(), r.Header.Get("Username"), id)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       id,
+		"status":   status,
+		"position": position,
+	})
+}
+
+func GetBoardHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := `SELECT id, title, description, COALESCE(status, $1), priority, position, due_date, due_all_day FROM task
+		WHERE deleted_at IS NULL ORDER BY position COLLATE "C" NULLS LAST, id`
+	rows, err := database.DB.QueryContext(r.Context(), query, defaultStatus)
+	if err != nil {
+		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	columns := make(map[string][]models.Task)
+	for _, status := range boardStatuses {
+		columns[status] = []models.Task{}
+	}
+	for rows.Next() {
+		var task models.Task
+		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.Position, &task.DueDate, &task.DueAllDay); err != nil {
+			http.Error(w, "Failed to scan todo", http.StatusInternalServerError)
+			return
+		}
+		columns[*task.Status] = append(columns[*task.Status], task)
+	}
+
+	// Known columns first, then any other status in alphabetical order
+	var extra []string
+	for status := range columns {
+		if !isBoardStatus(status) {
+			extra = append(extra, status)
+		}
+	}
+	sort.Strings(extra)
+
+	board := []boardColumn{}
+	for _, status := range append(append([]string{}, boardStatuses...), extra...) {
+		board = append(board, boardColumn{Status: status, Tasks: columns[status]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"columns": board,
+	})
+}
+
+// positionBetweenNeighbors returns a key between the given neighbors of a column.
+// A missing neighbor is resolved to the task currently adjacent to the given one.
+func positionBetweenNeighbors(ctx context.Context, id int, status string, before, after *int) (string, error) {
+	var lower, upper string
+	var err error
+
+	if before != nil {
+		if lower, err = neighborPosition(ctx, id, status, *before); err != nil {
+			return "", err
+		}
+	}
+	if after != nil {
+		if upper, err = neighborPosition(ctx, id, status, *after); err != nil {
+			return "", err
+		}
+	}
+
+	if before != nil && after == nil {
+		err = database.DB.QueryRowContext(ctx, `SELECT COALESCE(MIN(position COLLATE "C"), '') FROM task
+			WHERE COALESCE(status, $1) = $1 AND deleted_at IS NULL AND id <> $2 AND position COLLATE "C" > $3`,
+			status, id, lower).Scan(&upper)
+	} else if after != nil && before == nil {
+		err = database.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(position COLLATE "C"), '') FROM task
+			WHERE COALESCE(status, $1) = $1 AND deleted_at IS NULL AND id <> $2 AND position COLLATE "C" < $3`,
+			status, id, upper).Scan(&lower)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	position, err := utils.RankBetween(lower, upper)
+	if err == utils.ErrInvalidRank {
+		return "", errInvalidNeighbor
+	}
+	return position, err
+}
+
+func neighborPosition(ctx context.Context, id int, status string, neighbor int) (string, error) {
+	if neighbor == id {
+		return "", errInvalidNeighbor
+	}
+
+	var position sql.NullString
+	err := database.DB.QueryRowContext(ctx, "SELECT position FROM task WHERE id = $1 AND COALESCE(status, $2) = $2 AND deleted_at IS NULL",
+		neighbor, status).Scan(&position)
+	if err == sql.ErrNoRows || (err == nil && !position.Valid) {
+		return "", errInvalidNeighbor
+	}
+	return position.String, err
+}
+
+// NextPositionInColumn returns a key after the last task of a column
+func NextPositionInColumn(ctx context.Context, status string) (string, error) {
+	var last string
+	err := database.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(position COLLATE "C"), '') FROM task
+		WHERE COALESCE(status, $1) = $1 AND deleted_at IS NULL`, status).Scan(&last)
+	if err != nil {
+		return "", err
+	}
+	return utils.RankBetween(last, "")
+}
+
+func isBoardStatus(status string) bool {
+	for _, s := range boardStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
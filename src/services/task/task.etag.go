@@ -0,0 +1,23 @@
+package task
+
+import (
+	"be-golang-todo/src/helper/etag"
+	"net/http"
+)
+
+// TaskETag formats the version of a task as a strong entity tag
+func TaskETag(version int) string {
+	return etag.Format(version)
+}
+
+// requireIfMatch parses the If-Match header of a write to a task. Without one the write
+// could overwrite a change the client has not seen, so it is refused with 428.
+// "*" is accepted for clients that mean to write whatever the version.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (etag.IfMatch, bool) {
+	precondition := etag.ParseIfMatch(r)
+	if !precondition.Present {
+		http.Error(w, "Precondition required: send If-Match with the ETag of the task", http.StatusPreconditionRequired)
+		return precondition, false
+	}
+	return precondition, true
+}
@@ -0,0 +1,138 @@
+package task
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// exportFlushEvery is the number of rows written between flushes of the response
+const exportFlushEvery = 100
+
+// exportedTask is the representation of a task in exports, and of our own format in imports
+type exportedTask struct {
+	ID              int        `json:"id,omitempty"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	Status          string     `json:"status"`
+	Priority        string     `json:"priority"`
+	DueDate         *time.Time `json:"due_date"`
+	DueAllDay       bool       `json:"due_all_day"`
+	EstimateMinutes *int       `json:"estimate_minutes"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+	CreatedBy       string     `json:"created_by,omitempty"`
+}
+
+var exportCSVHeader = []string{"id", "title", "description", "status", "priority", "due_date", "estimate_minutes", "created_at", "created_by"}
+
+// ExportTasksHandler streams the tasks created by or assigned to the caller,
+// filtered like GetAllTaskPaginationHandler, without loading them all in memory.
+func ExportTasksHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "csv" && format != "json" && format != "ndjson" {
+		http.Error(w, "Format must be csv, json or ndjson", http.StatusBadRequest)
+		return
+	}
+
+	filter := parseTaskFilter(r)
+	filter.VisibleTo = r.Header.Get("Username")
+	where, args := filter.where()
+
+	rows, err := database.DB.QueryContext(r.Context(), `SELECT id, COALESCE(title, ''), COALESCE(description, ''), COALESCE(status, 'pending'), COALESCE(priority, 'P2'),
+		due_date, due_all_day, estimate_minutes, created_at, COALESCE(created_by, '') FROM task`+where+` ORDER BY id`, args...)
+	if err != nil {
+		logging.From(r).Error("failed to retrieve tasks", "error", err)
+		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	filename := "tasks-" + time.Now().Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	flusher, _ := w.(http.Flusher)
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+
+	switch format {
+	case "csv":
+		csvWriter.Write(exportCSVHeader)
+	case "json":
+		w.Write([]byte("["))
+	}
+
+	count := 0
+	for rows.Next() {
+		var t exportedTask
+		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.DueDate, &t.DueAllDay, &t.EstimateMinutes, &t.CreatedAt, &t.CreatedBy); err != nil {
+			// Headers are already sent, all that can be done is to stop the stream
+			logging.From(r).Error("task export interrupted", "error", err)
+			return
+		}
+
+		switch format {
+		case "csv":
+			csvWriter.Write(taskCSVRecord(t))
+		case "json":
+			if count > 0 {
+				w.Write([]byte(","))
+			}
+			encoder.Encode(t)
+		case "ndjson":
+			encoder.Encode(t)
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			csvWriter.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		logging.From(r).Error("task export interrupted", "error", err)
+		return
+	}
+
+	switch format {
+	case "csv":
+		csvWriter.Flush()
+	case "json":
+		w.Write([]byte("]\n"))
+	}
+}
+
+func taskCSVRecord(t exportedTask) []string {
+	dueDate, createdAt, estimate := "", "", ""
+	// A due date of a whole day is written without a time, which imports it as such again
+	if t.DueDate != nil && t.DueAllDay {
+		dueDate = t.DueDate.Format(time.DateOnly)
+	} else if t.DueDate != nil {
+		dueDate = t.DueDate.Format(time.RFC3339)
+	}
+	if t.CreatedAt != nil {
+		createdAt = t.CreatedAt.Format(time.RFC3339)
+	}
+	if t.EstimateMinutes != nil {
+		estimate = strconv.Itoa(*t.EstimateMinutes)
+	}
+	return []string{strconv.Itoa(t.ID), t.Title, t.Description, t.Status, t.Priority, dueDate, estimate, createdAt, t.CreatedBy}
+}
@@ -0,0 +1,63 @@
+package task
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// taskFilter holds the list filters shared by every query that lists tasks
+type taskFilter struct {
+	Status   string
+	Search   string
+	Assignee string
+
+	// VisibleTo limits the tasks to those a user has access to
+	VisibleTo string
+}
+
+func parseTaskFilter(r *http.Request) taskFilter {
+	filter := taskFilter{
+		Status:   r.URL.Query().Get("status"),
+		Search:   r.URL.Query().Get("search"),
+		Assignee: r.URL.Query().Get("assignee"),
+	}
+	if filter.Assignee == "me" {
+		filter.Assignee = r.Header.Get("Username")
+	}
+	return filter
+}
+
+// where builds the WHERE clause and its arguments, numbered from $1
+func (f taskFilter) where() (string, []interface{}) {
+	where := " WHERE 1=1 AND deleted_at IS NULL"
+	args := []interface{}{}
+	argID := 1
+
+	// Add status filter if provided
+	if f.Status != "" {
+		where += fmt.Sprintf(" AND status = $%d", argID)
+		args = append(args, f.Status)
+		argID++
+	}
+
+	// Add search filter if provided
+	if f.Search != "" {
+		where += fmt.Sprintf(" AND (title ILIKE $%d OR description ILIKE $%d)", argID, argID+1)
+		args = append(args, "%"+f.Search+"%", "%"+f.Search+"%")
+		argID += 2
+	}
+
+	// Add assignee filter if provided
+	if f.Assignee != "" {
+		where += fmt.Sprintf(" AND id IN (SELECT task_id FROM task_assignee WHERE username = $%d)", argID)
+		args = append(args, f.Assignee)
+		argID++
+	}
+
+	if f.VisibleTo != "" {
+		where += " AND " + visibleTo("task", argID)
+		args = append(args, f.VisibleTo)
+	}
+
+	return where, args
+}
@@ -3,12 +3,18 @@ package task
 import (
 	"be-golang-todo/models"
 	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/etag"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/metrics"
 	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/utils"
+	"be-golang-todo/src/services/notification"
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -35,23 +41,76 @@ func CreateTaskHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		return
 	}
 
+	if req.Priority == nil {
+		req.Priority = utils.StringPtr(defaultPriority)
+	}
+
+	// Assignees are checked first, a task is either created with all of them or not at all
+	if len(req.Assignees) > 0 {
+		unknown, err := unknownUsers(r.Context(), database.DB, req.Assignees)
+		if err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if len(unknown) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": map[string]string{"assignees": "Unknown users: " + strings.Join(unknown, ", ")},
+			})
+			return
+		}
+	}
+
+	// New tasks go to the bottom of the pending column
+	position, err := NextPositionInColumn(r.Context(), defaultStatus)
+	if err != nil {
+		http.Error(w, "Failed to create todo", http.StatusInternalServerError)
+		return
+	}
+	req.Position = &position
+
+	username := r.Header.Get("Username")
+	req.CreatedBy = &username
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	// Insert into the database
-	_, err := database.DB.Exec("INSERT INTO task (title, description, due_date) VALUES ($1, $2, $3)", req.Title, req.Description, req.DueDate)
+	err = tx.QueryRowContext(r.Context(), "INSERT INTO task (title, description, due_date, due_all_day, priority, position, estimate_minutes, created_by) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		req.Title, req.Description, req.DueDate, req.DueAllDay && req.DueDate != nil, req.Priority, req.Position, req.EstimateMinutes, req.CreatedBy).Scan(&req.ID)
+	var assigned []string
+	if err == nil && len(req.Assignees) > 0 {
+		assigned, err = addAssignees(r.Context(), tx, req.ID, username, req.Assignees)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		logging.From(r).Error("failed to create todo", "error", err)
 		http.Error(w, "Failed to create todo", http.StatusInternalServerError)
 		return
 	}
 
+	if err := notification.NotifyMentions(r.Context(), username, req.ID, *req.Description, ""); err != nil {
+		logging.From(r).Error("mention notification failed", "error", err)
+	}
+	notifyAssigned(r.Context(), req.ID, username, assigned)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(req)
 }
 
 func GetAllTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	cacheKey := "tasks:all"
-	fmt.Printf("request header: %s\n", r.Header.Get("Username"))
 
 	// Check if data is cached in Redis
-	cachedtasks, err := config.RDB.Get(config.CTX, cacheKey).Result()
+	cachedtasks, err := config.RDB.Get(r.Context(), cacheKey).Result()
 	if err == nil {
 		// Cache hit, return cached data
 		w.Header().Set("Content-Type", "application/json")
@@ -60,7 +119,7 @@ func GetAllTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	}
 
 	// Cache miss, query the database
-	rows, err := database.DB.Query("SELECT id, title, description, due_date FROM task")
+	rows, err := database.DB.QueryContext(r.Context(), "SELECT id, title, description, due_date FROM task")
 	if err != nil {
 		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
 		return
@@ -85,9 +144,9 @@ func GetAllTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 	}
 
 	// Cache result in Redis with a 2-minute expiration
-	err = config.RDB.Set(config.CTX, cacheKey, tasksJSON, 30*time.Second).Err()
+	err = config.RDB.Set(r.Context(), cacheKey, tasksJSON, 30*time.Second).Err()
 	if err != nil {
-		log.Println("Failed to cache data in Redis:", err)
+		logging.From(r).Warn("failed to cache tasks", "error", err)
 	}
 
 	// Return the response
@@ -97,8 +156,6 @@ func GetAllTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 func GetAllTaskPaginationHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// Parse query parameters
-	status := r.URL.Query().Get("status")
-	search := r.URL.Query().Get("search")
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
 
@@ -113,12 +170,14 @@ func GetAllTaskPaginationHandler(w http.ResponseWriter, r *http.Request, ps http
 	}
 	offset := (page - 1) * limit
 
+	filter := parseTaskFilter(r)
+
 	// Cache key with filters
-	cacheKey := fmt.Sprintf("tasks:%s:%s:%d:%d", status, search, page, limit)
-	fmt.Printf("request header: %s\n", r.Header.Get("Username"))
+	cacheKey := fmt.Sprintf("tasks:%s:%s:%s:%d:%d", filter.Status, filter.Search, filter.Assignee, page, limit)
 
 	// Check if data is cached in Redis
-	cachedtasks, err := config.RDB.Get(config.CTX, cacheKey).Result()
+	cachedtasks, err := config.RDB.Get(r.Context(), cacheKey).Result()
+	metrics.CacheLookup("task_list", err == nil)
 	if err == nil {
 		// Cache hit, return cached data
 		w.Header().Set("Content-Type", "application/json")
@@ -127,30 +186,16 @@ func GetAllTaskPaginationHandler(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	// Build the database query with filters
-	query := "SELECT id, title, description, due_date FROM task WHERE 1=1 AND deleted_at IS NULL"
-	args := []interface{}{}
-	argID := 1
-
-	// Add status filter if provided
-	if status != "" {
-		query += fmt.Sprintf(" AND status = $%d", argID)
-		args = append(args, status)
-		argID++
-	}
-
-	// Add search filter if provided
-	if search != "" {
-		query += fmt.Sprintf(" AND (title ILIKE $%d OR description ILIKE $%d)", argID, argID+1)
-		args = append(args, "%"+search+"%", "%"+search+"%")
-		argID += 2
-	}
+	where, args := filter.where()
+	query := `SELECT id, title, description, priority, due_date, due_all_day, version,
+		(SELECT COUNT(*) FROM comment WHERE comment.task_id = task.id AND comment.deleted_at IS NULL) FROM task` + where
 
 	// Add pagination
+	argID := len(args) + 1
 	query += fmt.Sprintf(" ORDER BY due_date LIMIT $%d OFFSET $%d", argID, argID+1)
-	args = append(args, limit, offset)
 
 	// Query the database
-	rows, err := database.DB.Query(query, args...)
+	rows, err := database.DB.QueryContext(r.Context(), query, append(args, limit, offset)...)
 	if err != nil {
 		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
 		return
@@ -160,23 +205,18 @@ func GetAllTaskPaginationHandler(w http.ResponseWriter, r *http.Request, ps http
 	var tasks []models.Task
 	for rows.Next() {
 		var task models.Task
-		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.DueDate); err != nil {
+		if err := rows.Scan(&task.ID, &task.Title, &task.Description, &task.Priority, &task.DueDate, &task.DueAllDay, &task.Version, &task.CommentCount); err != nil {
 			http.Error(w, "Failed to scan todo", http.StatusInternalServerError)
 			return
 		}
+		task.ETag = TaskETag(task.Version)
 		tasks = append(tasks, task)
 	}
 
 	// Get total count for pagination
 	var totalTasks int
-	countQuery := "SELECT COUNT(*) FROM task WHERE 1=1"
-	if status != "" {
-		countQuery += " AND status = $1"
-	}
-	if search != "" {
-		countQuery += " AND (title ILIKE $2 OR description ILIKE $3)"
-	}
-	database.DB.QueryRow(countQuery, args...).Scan(&totalTasks)
+	countQuery := "SELECT COUNT(*) FROM task" + where
+	database.DB.QueryRowContext(r.Context(), countQuery, args...).Scan(&totalTasks)
 
 	// Calculate total pages
 	totalPages := (totalTasks + limit - 1) / limit
@@ -197,9 +237,9 @@ func GetAllTaskPaginationHandler(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	// Cache result in Redis with a half-minute expiration
-	err = config.RDB.Set(config.CTX, cacheKey, responseJSON, 30*time.Second).Err()
+	err = config.RDB.Set(r.Context(), cacheKey, responseJSON, 30*time.Second).Err()
 	if err != nil {
-		log.Println("Failed to cache data in Redis:", err)
+		logging.From(r).Warn("failed to cache tasks", "error", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -211,21 +251,49 @@ func GetDetailTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.
 
 	if err != nil {
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
 	}
 
+	// Tasks the user has no access to are not found, like deleted ones
 	var task models.Task
-	row := database.DB.QueryRow("SELECT id, title, description, status FROM task WHERE ID = $1", id)
+	row := database.DB.QueryRowContext(r.Context(), `SELECT id, title, description, status, priority, position, due_date, due_all_day, estimate_minutes, version,
+		(SELECT COUNT(*) FROM comment WHERE comment.task_id = task.id AND comment.deleted_at IS NULL)
+		FROM task WHERE ID = $1 AND deleted_at IS NULL AND `+visibleTo("task", 2), id, r.Header.Get("Username"))
 
-	if err := row.Scan(&task.ID, &task.Title, &task.Description, &task.Status); err != nil {
+	if err := row.Scan(&task.ID, &task.Title, &task.Description, &task.Status, &task.Priority, &task.Position, &task.DueDate, &task.DueAllDay, &task.EstimateMinutes, &task.Version, &task.CommentCount); err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Todo not found", http.StatusNotFound)
 			return
 		}
-		fmt.Println(err)
+		logging.From(r).Error("database error", "error", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
+	task.ETag = TaskETag(task.Version)
+	w.Header().Set("ETag", task.ETag)
+	if etag.NoneMatch(r, task.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	assignees, err := taskAssignees(r.Context(), task.ID)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	task.Assignees = assignees
+
+	if task.Description != nil {
+		descriptionHTML, err := utils.RenderMarkdown(*task.Description)
+		if err != nil {
+			http.Error(w, "Failed to render description", http.StatusInternalServerError)
+			return
+		}
+		task.DescriptionHTML = &descriptionHTML
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(task)
 }
@@ -244,22 +312,88 @@ func UpdateTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	currentTime := time.Now()
+	// Validate the request data
+	errors := validateUpdateTaskRequest(task)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
 
-	query := `UPDATE task SET title = $1, description = $2, status = $3, updated_at = $4, updated_by = $5 WHERE id = $6`
-	res, err := database.DB.Exec(query, task.Title, task.Description, task.Status, currentTime, r.Header.Get("Username"), id)
-	if err != nil {
-		fmt.Println(err)
+	username := r.Header.Get("Username")
+	access, err := AccessFor(r.Context(), id, username)
+	if err == ErrTaskNotFound {
+		http.Error(w, "Todo not found or no changes made", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
+	// The write only happens if nobody changed the task since the client read it
+	precondition, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	currentTime := time.Now()
+
+	var version int
+	switch access {
+	case AccessOwner:
+		// Remember the description so that only users newly mentioned by this edit are notified
+		var previousDescription sql.NullString
+		if err := database.DB.QueryRowContext(r.Context(), "SELECT description FROM task WHERE id = $1", id).Scan(&previousDescription); err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		query := `UPDATE task SET title = $1, description = $2, status = $3, priority = COALESCE($4, priority),
+			estimate_minutes = COALESCE($5, estimate_minutes), updated_at = $6, updated_by = $7 WHERE id = $8`
+		// Fields left out of a PATCH keep their value, PUT replaces them
+		if r.Method == http.MethodPatch {
+			query = `UPDATE task SET title = COALESCE($1, title), description = COALESCE($2, description), status = COALESCE($3, status),
+				priority = COALESCE($4, priority), estimate_minutes = COALESCE($5, estimate_minutes), updated_at = $6, updated_by = $7 WHERE id = $8`
+		}
+		clause, clauseArgs := precondition.Clause(9)
+		err = database.DB.QueryRowContext(r.Context(), query+clause+" RETURNING version",
+			append([]interface{}{task.Title, task.Description, task.Status, task.Priority, task.EstimateMinutes, currentTime, username, id}, clauseArgs...)...).Scan(&version)
+		if err == nil && task.Description != nil {
+			if err := notification.NotifyMentions(r.Context(), username, id, *task.Description, previousDescription.String); err != nil {
+				logging.From(r).Error("mention notification failed", "error", err)
+			}
+		}
+	case AccessAssignee:
+		// Assignees may move the task through its workflow but not edit it
+		if task.Title != nil || task.Description != nil || task.Priority != nil || task.EstimateMinutes != nil || task.Status == nil {
+			http.Error(w, "Forbidden: assignees can only update the status", http.StatusForbidden)
+			return
+		}
+		query := `UPDATE task SET status = $1, updated_at = $2, updated_by = $3 WHERE id = $4`
+		clause, clauseArgs := precondition.Clause(5)
+		err = database.DB.QueryRowContext(r.Context(), query+clause+" RETURNING version",
+			append([]interface{}{task.Status, currentTime, username, id}, clauseArgs...)...).Scan(&version)
+	default:
+		http.Error(w, "Forbidden: not allowed to update this task", http.StatusForbidden)
+		return
+	}
+	if err == sql.ErrNoRows && !precondition.Any {
+		http.Error(w, "Precondition failed: the task was modified", http.StatusPreconditionFailed)
+		return
+	} else if err == sql.ErrNoRows {
 		http.Error(w, "Todo not found or no changes made", http.StatusNotFound)
 		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Set("ETag", TaskETag(version))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -270,21 +404,104 @@ func DeleteTaskHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
+	// ?purge=true removes the task for good, including its attachments
+	if r.URL.Query().Get("purge") == "true" {
+		purgeTask(w, r, id)
+		return
+	}
+
+	access, err := AccessFor(r.Context(), id, r.Header.Get("Username"))
+	if err == ErrTaskNotFound {
+		http.Error(w, "Task not found or already deleted", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if access != AccessOwner {
+		http.Error(w, "Forbidden: only the creator can delete this task", http.StatusForbidden)
+		return
+	}
+
+	precondition, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
 	currentTime := time.Now()
 
-	query := `UPDATE task SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`
-	res, err := database.DB.Exec(query, currentTime, id)
+	clause, clauseArgs := precondition.Clause(3)
+	query := `UPDATE task SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL` + clause
+	res, err := database.DB.ExecContext(r.Context(), query, append([]interface{}{currentTime, id}, clauseArgs...)...)
 	if err != nil {
-		fmt.Println(err)
+		logging.From(r).Error("database error", "error", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
+	if err == nil && rowsAffected == 0 && !precondition.Any {
+		http.Error(w, "Precondition failed: the task was modified", http.StatusPreconditionFailed)
+		return
+	} else if err != nil || rowsAffected == 0 {
 		http.Error(w, "Task not found or already deleted", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// purgeHooks remove what other services keep about a task, before it is purged
+var purgeHooks []func(ctx context.Context, taskID int) error
+
+// OnPurge registers a function removing what a service keeps about a task when it is purged,
+// what its rows cascade to does not need one. Attachments register the removal of their blobs.
+func OnPurge(hook func(ctx context.Context, taskID int) error) {
+	purgeHooks = append(purgeHooks, hook)
+}
+
+// purgeTask hard deletes a live or soft deleted task. Comments, assignees and
+// attachment rows cascade, the OnPurge hooks remove attachment blobs from the blob store.
+// Sync clients learn of it from the tombstone left in task_purged.
+func purgeTask(w http.ResponseWriter, r *http.Request, id int) {
+	var createdBy sql.NullString
+	var version int
+	err := database.DB.QueryRowContext(r.Context(), "SELECT created_by, version FROM task WHERE id = $1", id).Scan(&createdBy, &version)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if createdBy.Valid && createdBy.String != r.Header.Get("Username") {
+		http.Error(w, "Forbidden: only the creator can delete this task", http.StatusForbidden)
+		return
+	}
+	precondition, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	if !precondition.Matches(version) {
+		http.Error(w, "Precondition failed: the task was modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	for _, hook := range purgeHooks {
+		if err := hook(r.Context(), id); err != nil {
+			logging.From(r).Error("failed to purge task", "error", err)
+			http.Error(w, "Failed to purge task", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if _, err := database.DB.ExecContext(r.Context(), "DELETE FROM task WHERE id = $1", id); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
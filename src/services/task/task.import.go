@@ -0,0 +1,213 @@
+package task
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 5000
+)
+
+// Outcomes of an import row
+const (
+	importCreated = "created"
+	importValid   = "valid"
+	importSkipped = "skipped"
+	importError   = "error"
+)
+
+type importResult struct {
+	Row    int               `json:"row"`
+	Status string            `json:"status"`
+	ID     int               `json:"id,omitempty"`
+	Title  string            `json:"title,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// ImportTasksHandler creates tasks from an uploaded file, see parseImport for the formats.
+// The file is either the raw body or the "file" field of a multipart form. With dry_run=true
+// every row is validated and checked for duplicates but nothing is written.
+// A task is a duplicate when the caller already has a live task with the same title and due date.
+func ImportTasksHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	format := r.URL.Query().Get("format")
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var rows []importRow
+	file, err := importFile(r)
+	if err == nil {
+		rows, err = parseImport(format, file)
+	}
+	// Parsers wrap the read error, the file can be cut off anywhere
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Import file too large", http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) > maxImportRows {
+		http.Error(w, fmt.Sprintf("Import files are limited to %d rows", maxImportRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	username := r.Header.Get("Username")
+	seen := make(map[string]int)
+	lastPositions := make(map[string]string)
+	results := []importResult{}
+	summary := map[string]int{importCreated: 0, importValid: 0, importSkipped: 0, importError: 0}
+
+	for _, row := range rows {
+		result := importResult{Row: row.Row, Title: row.Task.Title}
+		t := row.Task
+		if t.Status == "" {
+			t.Status = defaultStatus
+		}
+		if t.Priority == "" {
+			t.Priority = defaultPriority
+		}
+
+		switch {
+		case row.Skip != "":
+			result.Status, result.Reason = importSkipped, row.Skip
+		case row.Err != "":
+			result.Status, result.Reason = importError, row.Err
+		default:
+			if errors := validateImportedTask(t); len(errors) > 0 {
+				result.Status, result.Errors = importError, errors
+				break
+			}
+
+			key := importDedupKey(t)
+			if previous, ok := seen[key]; ok {
+				result.Status, result.Reason = importSkipped, fmt.Sprintf("duplicate of row %d", previous)
+				break
+			}
+			seen[key] = row.Row
+
+			existingID, err := findDuplicateTask(r.Context(), username, t)
+			if err != nil {
+				logging.From(r).Error("task import failed", "error", err)
+				result.Status, result.Reason = importError, "database error"
+				break
+			}
+			if existingID != 0 {
+				result.Status, result.Reason, result.ID = importSkipped, "duplicate of an existing task", existingID
+				break
+			}
+
+			if dryRun {
+				result.Status = importValid
+				break
+			}
+
+			id, err := insertImportedTask(r.Context(), username, t, "", lastPositions)
+			if err != nil {
+				logging.From(r).Error("task import failed", "error", err)
+				result.Status, result.Reason = importError, "failed to create task"
+				break
+			}
+			result.Status, result.ID = importCreated, id
+		}
+
+		summary[result.Status]++
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dry_run": dryRun,
+		"summary": summary,
+		"rows":    results,
+	})
+}
+
+// importFile returns the uploaded file of a raw or multipart request
+func importFile(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("file is required")
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid multipart body: %w", err)
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+func importDedupKey(t exportedTask) string {
+	due := ""
+	if t.DueDate != nil {
+		due = t.DueDate.UTC().Format(time.RFC3339)
+	}
+	return t.Title + "\x00" + due
+}
+
+func findDuplicateTask(ctx context.Context, username string, t exportedTask) (int, error) {
+	var id int
+	err := database.DB.QueryRowContext(ctx, `SELECT COALESCE(MIN(id), 0) FROM task
+		WHERE created_by = $1 AND title = $2 AND due_date IS NOT DISTINCT FROM $3 AND deleted_at IS NULL`,
+		username, t.Title, t.DueDate).Scan(&id)
+	return id, err
+}
+
+// insertImportedTask creates a task at the bottom of its column. lastPositions caches
+// the last key of each column so that a large import does not look it up for every row.
+// A task created offline by a sync client is created once per clientID, "" for imports.
+func insertImportedTask(ctx context.Context, username string, t exportedTask, clientID string, lastPositions map[string]string) (int, error) {
+	var position string
+	var err error
+	if last, ok := lastPositions[t.Status]; ok {
+		position, err = utils.RankBetween(last, "")
+	} else {
+		position, err = NextPositionInColumn(ctx, t.Status)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = database.DB.QueryRowContext(ctx, `INSERT INTO task (title, description, status, priority, position, due_date, due_all_day, estimate_minutes, created_by, sync_client_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))
+		ON CONFLICT (created_by, sync_client_id) WHERE sync_client_id IS NOT NULL DO NOTHING RETURNING id`,
+		t.Title, t.Description, t.Status, t.Priority, position, t.DueDate, t.DueAllDay && t.DueDate != nil, t.EstimateMinutes, username, clientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		// Created by an earlier attempt of the same sync batch
+		err = database.DB.QueryRowContext(ctx, "SELECT id FROM task WHERE created_by = $1 AND sync_client_id = $2", username, clientID).Scan(&id)
+		return id, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	lastPositions[t.Status] = position
+	return id, nil
+}
@@ -0,0 +1,313 @@
+package task
+
+import (
+	"be-golang-todo/src/helper/ical"
+	"be-golang-todo/src/services/calendar"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importRow is one parsed record of an import file. Row is its 1-based number
+// not counting a header, Err a parse error and Skip the reason the record is not a task.
+type importRow struct {
+	Row  int
+	Task exportedTask
+	Err  string
+	Skip string
+}
+
+var importDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", time.DateOnly}
+
+// parseImport reads a whole import file in one of the supported formats:
+// csv (our export), json or ndjson (our export), todoist (Todoist CSV template), trello (Trello board JSON)
+// and ics (iCalendar VTODO and VEVENT entries).
+func parseImport(format string, r io.Reader) ([]importRow, error) {
+	switch format {
+	case "csv":
+		return parseTaskCSV(r)
+	case "json":
+		return parseTaskJSON(r)
+	case "ndjson":
+		return parseTaskNDJSON(r)
+	case "todoist":
+		return parseTodoistCSV(r)
+	case "trello":
+		return parseTrelloJSON(r)
+	case "ics":
+		return parseICS(r)
+	}
+	return nil, errors.New("format must be one of csv, json, ndjson, todoist, trello, ics")
+}
+
+func parseTaskCSV(r io.Reader) ([]importRow, error) {
+	records, columns, err := readCSVWithHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("CSV header must contain a title column")
+	}
+
+	var rows []importRow
+	for i, record := range records {
+		row := importRow{Row: i + 1}
+		field := func(name string) string { return csvField(record, columns, name) }
+
+		row.Task = exportedTask{
+			Title:       field("title"),
+			Description: field("description"),
+			Status:      field("status"),
+			Priority:    field("priority"),
+		}
+		if value := field("due_date"); value != "" {
+			if row.Task.DueDate, row.Task.DueAllDay, err = parseImportDate(value); err != nil {
+				row.Err = err.Error()
+			}
+		}
+		if value := field("estimate_minutes"); value != "" {
+			estimate, err := strconv.Atoi(value)
+			if err != nil {
+				row.Err = "estimate_minutes must be a whole number"
+			}
+			row.Task.EstimateMinutes = &estimate
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseTaskJSON(r io.Reader) ([]importRow, error) {
+	var tasks []exportedTask
+	if err := json.NewDecoder(r).Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	rows := make([]importRow, len(tasks))
+	for i, t := range tasks {
+		t.ID = 0
+		rows[i] = importRow{Row: i + 1, Task: t}
+	}
+	return rows, nil
+}
+
+func parseTaskNDJSON(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := importRow{Row: line}
+		if err := json.Unmarshal(text, &row.Task); err != nil {
+			row.Err = "invalid JSON: " + err.Error()
+		}
+		row.Task.ID = 0
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// parseTodoistCSV reads the CSV template Todoist exports per project.
+// Only TYPE=task records are tasks, Todoist priority 4 (urgent) maps to P0 and 1 (normal) to P3.
+func parseTodoistCSV(r io.Reader) ([]importRow, error) {
+	records, columns, err := readCSVWithHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := columns["content"]; !ok {
+		return nil, errors.New("not a Todoist CSV export, CONTENT column is missing")
+	}
+
+	var rows []importRow
+	for i, record := range records {
+		row := importRow{Row: i + 1}
+		field := func(name string) string { return csvField(record, columns, name) }
+
+		if recordType := strings.ToLower(field("type")); recordType != "" && recordType != "task" {
+			row.Skip = "not a task: " + recordType
+			rows = append(rows, row)
+			continue
+		}
+
+		row.Task = exportedTask{
+			Title:       field("content"),
+			Description: field("description"),
+			Status:      defaultStatus,
+			Priority:    defaultPriority,
+		}
+		switch field("priority") {
+		case "4":
+			row.Task.Priority = "P0"
+		case "3":
+			row.Task.Priority = "P1"
+		case "2":
+			row.Task.Priority = "P2"
+		case "1":
+			row.Task.Priority = "P3"
+		}
+		// Recurring or natural language dates ("every monday") are not supported and ignored
+		if value := field("date"); value != "" {
+			row.Task.DueDate, row.Task.DueAllDay, _ = parseImportDate(value)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+type trelloBoard struct {
+	Lists []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"lists"`
+	Cards []struct {
+		Name        string  `json:"name"`
+		Desc        string  `json:"desc"`
+		Due         *string `json:"due"`
+		DueComplete bool    `json:"dueComplete"`
+		Closed      bool    `json:"closed"`
+		IDList      string  `json:"idList"`
+	} `json:"cards"`
+}
+
+// parseTrelloJSON reads a Trello board export. The list a card is in is mapped to a status,
+// archived cards are skipped.
+func parseTrelloJSON(r io.Reader) ([]importRow, error) {
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, fmt.Errorf("invalid Trello export: %w", err)
+	}
+
+	listStatus := make(map[string]string)
+	for _, list := range board.Lists {
+		listStatus[list.ID] = statusFromListName(list.Name)
+	}
+
+	rows := make([]importRow, len(board.Cards))
+	for i, card := range board.Cards {
+		row := importRow{Row: i + 1}
+		if card.Closed {
+			row.Skip = "archived card"
+			rows[i] = row
+			continue
+		}
+
+		row.Task = exportedTask{
+			Title:       card.Name,
+			Description: card.Desc,
+			Status:      listStatus[card.IDList],
+			Priority:    defaultPriority,
+		}
+		if row.Task.Status == "" {
+			row.Task.Status = defaultStatus
+		}
+		if card.DueComplete {
+			row.Task.Status = "done"
+		}
+		if card.Due != nil && *card.Due != "" {
+			var err error
+			if row.Task.DueDate, row.Task.DueAllDay, err = parseImportDate(*card.Due); err != nil {
+				row.Err = err.Error()
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// parseICS reads the VTODO and VEVENT entries of an iCalendar file, other components are ignored
+func parseICS(r io.Reader) ([]importRow, error) {
+	cal, err := ical.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if cal.Name != "VCALENDAR" {
+		return nil, errors.New("not an iCalendar file")
+	}
+
+	var rows []importRow
+	for _, component := range cal.Components {
+		if component.Name != "VTODO" && component.Name != "VEVENT" {
+			continue
+		}
+		row := importRow{Row: len(rows) + 1}
+		t, err := calendar.TaskFromComponent(component)
+		if err != nil {
+			row.Err = err.Error()
+		}
+		row.Task = exportedTask{
+			Title:       t.Title,
+			Description: t.Description,
+			Status:      t.Status,
+			Priority:    t.Priority,
+			DueDate:     t.DueDate,
+			DueAllDay:   t.DueAllDay,
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func statusFromListName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "done") || strings.Contains(name, "complete"):
+		return "done"
+	case strings.Contains(name, "doing") || strings.Contains(name, "progress"):
+		return "in_progress"
+	}
+	return defaultStatus
+}
+
+// readCSVWithHeader returns the records after the header and the index of every lower cased column name
+func readCSVWithHeader(r io.Reader) ([][]string, map[string]int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("the file is empty")
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheet tools like to prepend a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return records, columns, nil
+}
+
+func csvField(record []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// parseImportDate reads a due date, one given without a time of day is a whole day
+func parseImportDate(value string) (*time.Time, bool, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, layout == time.DateOnly, nil
+		}
+	}
+	return nil, false, fmt.Errorf("invalid date %q", value)
+}
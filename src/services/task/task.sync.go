@@ -0,0 +1,390 @@
+package task
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	syncPageSize     = 500
+	syncMaxBatchSize = 500
+)
+
+// syncFields are the fields a client may change, in the order they are written
+var syncFields = []string{"title", "description", "status", "priority", "due_date", "due_all_day", "estimate_minutes"}
+
+// Results of a pushed change
+const (
+	syncCreated  = "created"
+	syncUpdated  = "updated"
+	syncDeleted  = "deleted"
+	syncConflict = "conflict"
+	syncRejected = "rejected"
+)
+
+// syncTask is a task as sent to sync clients
+type syncTask struct {
+	exportedTask
+	Position  *string    `json:"position"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// syncChange is a change made offline by a client. Token is the sync token the client had
+// when it made the change, ID is empty for a task created offline, which ClientID then identifies.
+// Fields holds only the fields that were changed.
+type syncChange struct {
+	ClientID string          `json:"client_id"`
+	ID       *int            `json:"id"`
+	Deleted  bool            `json:"deleted"`
+	Fields   json.RawMessage `json:"fields"`
+}
+
+type syncRequest struct {
+	Token   string       `json:"token"`
+	Changes []syncChange `json:"changes"`
+}
+
+// syncResult reports what happened to a pushed change. Conflicts lists the fields
+// that were changed on the server since the client's token and kept the server value.
+type syncResult struct {
+	ClientID  string            `json:"client_id,omitempty"`
+	ID        int               `json:"id,omitempty"`
+	Result    string            `json:"result"`
+	Conflicts []string          `json:"conflicts,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// GetSyncHandler returns the tasks created, updated or deleted since a sync token.
+// Without a token every live task is returned. Pages are followed with the returned token while has_more is set.
+func GetSyncHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	since, err := parseSyncToken(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid sync token", http.StatusBadRequest)
+		return
+	}
+
+	writeTaskChanges(w, r, r.Header.Get("Username"), since, nil)
+}
+
+// PostSyncHandler applies a batch of offline changes, then returns the changes since
+// the client's token like GetSyncHandler, including the ones just applied.
+// Fields changed on both sides are resolved per field in favour of the server.
+// A batch that failed halfway can be sent again: tasks are created once per client_id.
+func PostSyncHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateSyncRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	since, err := parseSyncToken(req.Token)
+	if err != nil {
+		http.Error(w, "Invalid sync token", http.StatusBadRequest)
+		return
+	}
+
+	username := r.Header.Get("Username")
+	lastPositions := make(map[string]string)
+	results := make([]syncResult, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		result, err := applySyncChange(r.Context(), username, since, change, lastPositions)
+		if err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, result)
+	}
+
+	writeTaskChanges(w, r, username, since, results)
+}
+
+func writeTaskChanges(w http.ResponseWriter, r *http.Request, username string, since int64, results []syncResult) {
+	tasks, deleted, token, hasMore, err := taskChangesSince(r.Context(), username, since)
+	if err != nil {
+		logging.From(r).Error("failed to retrieve tasks", "error", err)
+		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"tasks":    tasks,
+		"deleted":  deleted,
+		"token":    strconv.FormatInt(token, 10),
+		"has_more": hasMore,
+	}
+	if results != nil {
+		response["results"] = results
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseSyncToken reads the change sequence number a token stands for, "" is the start of time
+func parseSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, fmt.Errorf("invalid sync token %q", token)
+	}
+	return seq, nil
+}
+
+// taskChangesSince returns one page of tasks changed after the given sequence number
+// and the ids of those deleted, in change order, with the token to continue from.
+// Tasks the user was unassigned from count as deleted for them, purged tasks as deleted
+// for everyone who could see them.
+// Tombstones are left out of a full sync since the client has nothing to delete.
+func taskChangesSince(ctx context.Context, username string, since int64) ([]syncTask, []int, int64, bool, error) {
+	const columns = `t.id, COALESCE(t.title, ''), COALESCE(t.description, ''), COALESCE(t.status, $1), COALESCE(t.priority, $2),
+		t.due_date, t.due_all_day, t.estimate_minutes, t.created_at, COALESCE(t.created_by, ''), t.position, t.updated_at`
+	visible := visibleTo("t", 4)
+
+	query := `SELECT ` + columns + `, t.deleted_at IS NOT NULL, t.change_seq
+		FROM task t WHERE t.change_seq > $3 AND ` + visible
+	if since == 0 {
+		query += ` AND t.deleted_at IS NULL`
+	} else {
+		query += ` UNION ALL SELECT ` + columns + `, true, r.change_seq
+			FROM task_access_revoked r JOIN task t ON t.id = r.task_id
+			WHERE r.username = $4 AND r.change_seq > $3 AND NOT ` + visible + `
+			UNION ALL SELECT p.task_id, '', '', '', '', NULL, false, NULL, NULL, '', NULL, NULL, true, p.change_seq
+			FROM task_purged p WHERE p.change_seq > $3 AND (p.created_by IS NULL OR p.created_by = $4 OR $4 = ANY(p.usernames))`
+	}
+	query += ` ORDER BY 14 LIMIT $5`
+
+	rows, err := database.DB.QueryContext(ctx, query, defaultStatus, defaultPriority, since, username, syncPageSize+1)
+	if err != nil {
+		return nil, nil, 0, false, err
+	}
+	defer rows.Close()
+
+	tasks := []syncTask{}
+	deleted := []int{}
+	token := since
+	count := 0
+	hasMore := false
+	for rows.Next() {
+		if count == syncPageSize {
+			hasMore = true
+			break
+		}
+		count++
+
+		var t syncTask
+		var isDeleted bool
+		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.Priority, &t.DueDate, &t.DueAllDay, &t.EstimateMinutes,
+			&t.CreatedAt, &t.CreatedBy, &t.Position, &t.UpdatedAt, &isDeleted, &token); err != nil {
+			return nil, nil, 0, false, err
+		}
+		if isDeleted {
+			deleted = append(deleted, t.ID)
+		} else {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, deleted, token, hasMore, rows.Err()
+}
+
+// applySyncChange creates, updates or deletes one task. Only database failures are returned
+// as errors, everything else is reported in the result.
+func applySyncChange(ctx context.Context, username string, since int64, change syncChange, lastPositions map[string]string) (syncResult, error) {
+	result := syncResult{ClientID: change.ClientID}
+
+	var sent map[string]json.RawMessage
+	var values exportedTask
+	if len(change.Fields) > 0 {
+		if err := json.Unmarshal(change.Fields, &sent); err != nil {
+			result.Result = syncRejected
+			result.Errors = map[string]string{"fields": "Fields must be an object"}
+			return result, nil
+		}
+		if err := json.Unmarshal(change.Fields, &values); err != nil {
+			result.Result = syncRejected
+			result.Errors = map[string]string{"fields": "Invalid field value: " + err.Error()}
+			return result, nil
+		}
+	}
+
+	if change.ID == nil {
+		if values.Status == "" {
+			values.Status = defaultStatus
+		}
+		if values.Priority == "" {
+			values.Priority = defaultPriority
+		}
+		if errors := validateImportedTask(values); len(errors) > 0 {
+			result.Result = syncRejected
+			result.Errors = errors
+			return result, nil
+		}
+		id, err := insertImportedTask(ctx, username, values, change.ClientID, lastPositions)
+		if err != nil {
+			return result, err
+		}
+		result.ID = id
+		result.Result = syncCreated
+		return result, nil
+	}
+	result.ID = *change.ID
+
+	current, fieldSeq, isDeleted, err := loadSyncTask(ctx, *change.ID, username)
+	if err == sql.ErrNoRows {
+		result.Result = syncRejected
+		result.Errors = map[string]string{"id": "Task not found"}
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+	// A task deleted on the server stays deleted, the client learns it from the tombstone
+	if isDeleted {
+		result.Result = syncConflict
+		result.Conflicts = []string{"deleted"}
+		return result, nil
+	}
+
+	access, err := AccessFor(ctx, *change.ID, username)
+	if err == ErrTaskNotFound {
+		result.Result = syncConflict
+		result.Conflicts = []string{"deleted"}
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+
+	if change.Deleted {
+		if access != AccessOwner {
+			result.Result = syncRejected
+			result.Errors = map[string]string{"deleted": "Only the creator can delete this task"}
+			return result, nil
+		}
+		// Deleting a task that someone changed in the meantime would lose their edit
+		for field, seq := range fieldSeq {
+			if seq > since {
+				result.Conflicts = append(result.Conflicts, field)
+			}
+		}
+		if len(result.Conflicts) > 0 {
+			result.Result = syncConflict
+			return result, nil
+		}
+		if _, err := database.DB.ExecContext(ctx, "UPDATE task SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", time.Now(), *change.ID); err != nil {
+			return result, err
+		}
+		result.Result = syncDeleted
+		return result, nil
+	}
+
+	// Keep the fields the client changed unless the server changed them too
+	merged := current
+	var columns []string
+	var args []interface{}
+	for _, field := range syncFields {
+		if _, ok := sent[field]; !ok {
+			continue
+		}
+		if fieldSeq[field] > since {
+			result.Conflicts = append(result.Conflicts, field)
+			continue
+		}
+		if access != AccessOwner && field != "status" {
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[field] = "Assignees can only update the status"
+			continue
+		}
+
+		switch field {
+		case "title":
+			merged.Title = values.Title
+			args = append(args, values.Title)
+		case "description":
+			merged.Description = values.Description
+			args = append(args, values.Description)
+		case "status":
+			merged.Status = values.Status
+			args = append(args, values.Status)
+		case "priority":
+			merged.Priority = values.Priority
+			args = append(args, values.Priority)
+		case "due_date":
+			merged.DueDate = values.DueDate
+			args = append(args, values.DueDate)
+		case "due_all_day":
+			merged.DueAllDay = values.DueAllDay
+			args = append(args, values.DueAllDay)
+		case "estimate_minutes":
+			merged.EstimateMinutes = values.EstimateMinutes
+			args = append(args, values.EstimateMinutes)
+		}
+		columns = append(columns, fmt.Sprintf("%s = $%d", field, len(args)))
+	}
+
+	errors := validateImportedTask(merged.exportedTask)
+	if merged.Status == "" {
+		errors["status"] = "Status cannot be empty"
+	}
+	if len(errors) > 0 {
+		result.Result = syncRejected
+		result.Errors = errors
+		return result, nil
+	}
+
+	result.Result = syncUpdated
+	if len(columns) == 0 {
+		return result, nil
+	}
+
+	args = append(args, time.Now(), username, *change.ID)
+	query := fmt.Sprintf("UPDATE task SET %s, updated_at = $%d, updated_by = $%d WHERE id = $%d AND deleted_at IS NULL",
+		strings.Join(columns, ", "), len(args)-2, len(args)-1, len(args))
+	if _, err := database.DB.ExecContext(ctx, query, args...); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// loadSyncTask reads a live or deleted task visible to the user with the change that last modified each field
+func loadSyncTask(ctx context.Context, id int, username string) (syncTask, map[string]int64, bool, error) {
+	var t syncTask
+	var fieldSeqJSON []byte
+	var isDeleted bool
+	err := database.DB.QueryRowContext(ctx, `SELECT id, COALESCE(title, ''), COALESCE(description, ''), COALESCE(status, $1), COALESCE(priority, $2),
+		due_date, due_all_day, estimate_minutes, field_seq, deleted_at IS NOT NULL FROM task
+		WHERE id = $3 AND `+visibleTo("task", 4),
+		defaultStatus, defaultPriority, id, username).Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.Priority,
+		&t.DueDate, &t.DueAllDay, &t.EstimateMinutes, &fieldSeqJSON, &isDeleted)
+	if err != nil {
+		return t, nil, false, err
+	}
+
+	fieldSeq := make(map[string]int64)
+	if err := json.Unmarshal(fieldSeqJSON, &fieldSeq); err != nil {
+		return t, nil, false, err
+	}
+	return t, fieldSeq, isDeleted, nil
+}
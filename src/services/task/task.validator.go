@@ -2,6 +2,7 @@ package task
 
 import (
 	"be-golang-todo/models"
+	"fmt"
 )
 
 func validateCreateTaskRequest(req models.Task) map[string]string {
@@ -14,5 +15,89 @@ func validateCreateTaskRequest(req models.Task) map[string]string {
 	if len(*req.Description) == 0 {
 		errors["description"] = "Description is required"
 	}
+	if req.Priority != nil && !isValidPriority(*req.Priority) {
+		errors["priority"] = "Priority must be one of P0, P1, P2, P3, P4"
+	}
+	if req.EstimateMinutes != nil && *req.EstimateMinutes < 0 {
+		errors["estimate_minutes"] = "Estimate cannot be negative"
+	}
+	return errors
+}
+
+func validateUpdateTaskRequest(req models.Task) map[string]string {
+	errors := make(map[string]string)
+	if req.Priority != nil && !isValidPriority(*req.Priority) {
+		errors["priority"] = "Priority must be one of P0, P1, P2, P3, P4"
+	}
+	if req.EstimateMinutes != nil && *req.EstimateMinutes < 0 {
+		errors["estimate_minutes"] = "Estimate cannot be negative"
+	}
 	return errors
 }
+
+func validateMoveTaskRequest(req moveTaskRequest) map[string]string {
+	errors := make(map[string]string)
+	if req.Status != nil && len(*req.Status) == 0 {
+		errors["status"] = "Status cannot be empty"
+	}
+	if req.Before != nil && req.After != nil && *req.Before == *req.After {
+		errors["after"] = "Before and after must be different tasks"
+	}
+	return errors
+}
+
+func validateAssignTaskRequest(req assignTaskRequest) map[string]string {
+	errors := make(map[string]string)
+	if len(req.Usernames) == 0 {
+		errors["usernames"] = "At least one username is required"
+	}
+	for _, username := range req.Usernames {
+		if len(username) == 0 {
+			errors["usernames"] = "Usernames cannot be empty"
+		}
+	}
+	return errors
+}
+
+func validateImportedTask(t exportedTask) map[string]string {
+	errors := make(map[string]string)
+	if len(t.Title) == 0 {
+		errors["title"] = "Title is required"
+	} else if len(t.Title) > 255 {
+		errors["title"] = "Title must be at most 255 characters"
+	}
+	if t.Priority != "" && !isValidPriority(t.Priority) {
+		errors["priority"] = "Priority must be one of P0, P1, P2, P3, P4"
+	}
+	if t.EstimateMinutes != nil && *t.EstimateMinutes < 0 {
+		errors["estimate_minutes"] = "Estimate cannot be negative"
+	}
+	return errors
+}
+
+func validateSyncRequest(req syncRequest) map[string]string {
+	errors := make(map[string]string)
+	if len(req.Changes) > syncMaxBatchSize {
+		errors["changes"] = fmt.Sprintf("At most %d changes can be sent at once", syncMaxBatchSize)
+	}
+	for i, change := range req.Changes {
+		if change.ID == nil && change.ClientID == "" {
+			errors[fmt.Sprintf("changes[%d].client_id", i)] = "New tasks need a client_id"
+		}
+		if len(change.ClientID) > 255 {
+			errors[fmt.Sprintf("changes[%d].client_id", i)] = "client_id must be at most 255 characters"
+		}
+		if change.ID == nil && change.Deleted {
+			errors[fmt.Sprintf("changes[%d].deleted", i)] = "Only existing tasks can be deleted"
+		}
+	}
+	return errors
+}
+
+func isValidPriority(priority string) bool {
+	switch priority {
+	case "P0", "P1", "P2", "P3", "P4":
+		return true
+	}
+	return false
+}
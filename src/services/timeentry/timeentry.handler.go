@@ -0,0 +1,226 @@
+package timeentry
+
+import (
+	"be-golang-todo/models"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/services/task"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lib/pq"
+)
+
+const (
+	sourceTimer  = "timer"
+	sourceManual = "manual"
+)
+
+// entryColumns are selected by every query returning time entries, minutes of a running timer count up to now
+const entryColumns = `id, task_id, username, started_at, ended_at, note, source, created_at,
+	EXTRACT(EPOCH FROM (COALESCE(ended_at, now()) - started_at)) / 60`
+
+type createTimeEntryRequest struct {
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Minutes   *int       `json:"minutes"`
+	Note      *string    `json:"note"`
+}
+
+func StartTimerHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	// The partial unique index on running entries rejects a second timer for the same user
+	row := database.DB.QueryRowContext(r.Context(), `INSERT INTO time_entry (task_id, username, started_at, source) VALUES ($1, $2, now(), $3)
+		RETURNING `+entryColumns, taskID, r.Header.Get("Username"), sourceTimer)
+	entry, err := scanTimeEntry(row)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "A timer is already running, stop it first", http.StatusConflict)
+		return
+	} else if err != nil {
+		logging.From(r).Error("failed to start timer", "error", err)
+		http.Error(w, "Failed to start timer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+func StopTimerHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	row := database.DB.QueryRowContext(r.Context(), `UPDATE time_entry SET ended_at = now() WHERE username = $1 AND task_id = $2 AND ended_at IS NULL
+		RETURNING `+entryColumns, r.Header.Get("Username"), taskID)
+	entry, err := scanTimeEntry(row)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No timer running on this task", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("failed to stop timer", "error", err)
+		http.Error(w, "Failed to stop timer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+func GetRunningTimerHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	row := database.DB.QueryRowContext(r.Context(), `SELECT `+entryColumns+` FROM time_entry WHERE username = $1 AND ended_at IS NULL`, r.Header.Get("Username"))
+	entry, err := scanTimeEntry(row)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No timer running", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+func CreateTimeEntryHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req createTimeEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateCreateTimeEntryRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	endedAt := req.EndedAt
+	if endedAt == nil {
+		end := req.StartedAt.Add(time.Duration(*req.Minutes) * time.Minute)
+		endedAt = &end
+	}
+
+	row := database.DB.QueryRowContext(r.Context(), `INSERT INTO time_entry (task_id, username, started_at, ended_at, note, source) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+entryColumns, taskID, r.Header.Get("Username"), req.StartedAt, endedAt, req.Note, sourceManual)
+	entry, err := scanTimeEntry(row)
+	if err != nil {
+		logging.From(r).Error("failed to create time entry", "error", err)
+		http.Error(w, "Failed to create time entry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+func GetTaskTimeEntriesHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	taskID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if !task.RequireAccess(w, r, taskID, r.Header.Get("Username"), task.AccessAssignee) {
+		return
+	}
+
+	rows, err := database.DB.QueryContext(r.Context(), `SELECT `+entryColumns+` FROM time_entry WHERE task_id = $1 ORDER BY started_at, id`, taskID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve time entries", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	var totalMinutes float64
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan time entry", http.StatusInternalServerError)
+			return
+		}
+		totalMinutes += *entry.Minutes
+		entries = append(entries, entry)
+	}
+
+	var estimate sql.NullInt64
+	database.DB.QueryRowContext(r.Context(), "SELECT estimate_minutes FROM task WHERE id = $1", taskID).Scan(&estimate)
+
+	response := map[string]interface{}{
+		"time_entries":  entries,
+		"total_minutes": totalMinutes,
+	}
+	if estimate.Valid {
+		response["estimate_minutes"] = estimate.Int64
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func DeleteTimeEntryHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Users can only delete their own entries
+	res, err := database.DB.ExecContext(r.Context(), "DELETE FROM time_entry WHERE id = $1 AND username = $2", id, r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Time entry not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTimeEntry(row rowScanner) (models.TimeEntry, error) {
+	var entry models.TimeEntry
+	err := row.Scan(&entry.ID, &entry.TaskID, &entry.Username, &entry.StartedAt, &entry.EndedAt, &entry.Note, &entry.Source, &entry.CreatedAt, &entry.Minutes)
+	return entry, err
+}
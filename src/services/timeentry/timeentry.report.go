@@ -0,0 +1,147 @@
+package timeentry
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// reportGroups maps the group_by values to the key and label columns of the report.
+// Tasks have no project or tag, so instead of those logged time is grouped by task, day or user;
+// the date range is the from and to filter.
+var reportGroups = map[string][2]string{
+	"task": {"task.id::varchar", "task.title"},
+	"date": {"to_char(time_entry.started_at, 'YYYY-MM-DD')", "to_char(time_entry.started_at, 'YYYY-MM-DD')"},
+	"user": {"time_entry.username", "time_entry.username"},
+}
+
+type reportRow struct {
+	Key     string  `json:"key"`
+	Label   string  `json:"label"`
+	Entries int     `json:"entries"`
+	Minutes float64 `json:"minutes"`
+}
+
+// GetTimeReportHandler aggregates finished time entries of a date range.
+// scope=mine covers the caller's own entries, scope=owned every entry on tasks the caller created.
+func GetTimeReportHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+	groupBy := withDefault(query.Get("group_by"), "task")
+	scope := withDefault(query.Get("scope"), "mine")
+	format := withDefault(query.Get("format"), "json")
+
+	// Default to the last 30 days, "to" is exclusive
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	// Validate the request data
+	errors := validateReportRequest(groupBy, scope, format, from, to)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	group := reportGroups[groupBy]
+	scopeFilter := "time_entry.username = $1"
+	if scope == "owned" {
+		scopeFilter = "task.created_by = $1"
+	}
+
+	sqlQuery := fmt.Sprintf(`SELECT %s, %s, COUNT(*), SUM(EXTRACT(EPOCH FROM (time_entry.ended_at - time_entry.started_at)) / 60)
+		FROM time_entry JOIN task ON task.id = time_entry.task_id
+		WHERE %s AND time_entry.ended_at IS NOT NULL AND time_entry.started_at >= $2 AND time_entry.started_at < $3
+		GROUP BY 1, 2 ORDER BY 1`, group[0], group[1], scopeFilter)
+
+	rows, err := database.DB.QueryContext(r.Context(), sqlQuery, r.Header.Get("Username"), from, to)
+	if err != nil {
+		logging.From(r).Error("failed to build report", "error", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := []reportRow{}
+	var totalMinutes float64
+	for rows.Next() {
+		var row reportRow
+		var label *string
+		if err := rows.Scan(&row.Key, &label, &row.Entries, &row.Minutes); err != nil {
+			logging.From(r).Error("failed to scan report", "error", err)
+			http.Error(w, "Failed to scan report", http.StatusInternalServerError)
+			return
+		}
+		if label != nil {
+			row.Label = *label
+		}
+		totalMinutes += row.Minutes
+		report = append(report, row)
+	}
+	if err := rows.Err(); err != nil {
+		logging.From(r).Error("failed to build report", "error", err)
+		http.Error(w, "Failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		filename := fmt.Sprintf("time-report-%s-%s.csv", from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		writer := csv.NewWriter(w)
+		writer.Write([]string{groupBy, "label", "entries", "minutes", "hours"})
+		for _, row := range report {
+			writer.Write([]string{
+				row.Key,
+				row.Label,
+				strconv.Itoa(row.Entries),
+				strconv.FormatFloat(row.Minutes, 'f', 1, 64),
+				strconv.FormatFloat(row.Minutes/60, 'f', 2, 64),
+			})
+		}
+		writer.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group_by":      groupBy,
+		"scope":         scope,
+		"from":          from.Format("2006-01-02"),
+		"to":            to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"rows":          report,
+		"total_minutes": totalMinutes,
+	})
+}
+
+func withDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,50 @@
+package timeentry
+
+import (
+	"time"
+)
+
+const maxEntryDuration = 24 * time.Hour
+
+func validateCreateTimeEntryRequest(req createTimeEntryRequest) map[string]string {
+	errors := make(map[string]string)
+	if req.StartedAt == nil {
+		errors["started_at"] = "Start time is required"
+	} else if req.StartedAt.After(time.Now()) {
+		errors["started_at"] = "Start time cannot be in the future"
+	}
+	if req.EndedAt == nil && req.Minutes == nil {
+		errors["ended_at"] = "Either an end time or minutes is required"
+	} else if req.EndedAt != nil && req.Minutes != nil {
+		errors["ended_at"] = "Give either an end time or minutes, not both"
+	} else if req.Minutes != nil && (*req.Minutes <= 0 || time.Duration(*req.Minutes)*time.Minute > maxEntryDuration) {
+		errors["minutes"] = "Minutes must be between 1 and 1440"
+	} else if req.EndedAt != nil && req.StartedAt != nil {
+		if !req.EndedAt.After(*req.StartedAt) {
+			errors["ended_at"] = "End time must be after the start time"
+		} else if req.EndedAt.Sub(*req.StartedAt) > maxEntryDuration {
+			errors["ended_at"] = "An entry cannot be longer than 24 hours"
+		}
+	}
+	if req.Note != nil && len(*req.Note) > 1000 {
+		errors["note"] = "Note must be at most 1000 characters"
+	}
+	return errors
+}
+
+func validateReportRequest(groupBy string, scope string, format string, from time.Time, to time.Time) map[string]string {
+	errors := make(map[string]string)
+	if _, ok := reportGroups[groupBy]; !ok {
+		errors["group_by"] = "Group by must be one of task, date, user"
+	}
+	if scope != "mine" && scope != "owned" {
+		errors["scope"] = "Scope must be mine or owned"
+	}
+	if format != "json" && format != "csv" {
+		errors["format"] = "Format must be json or csv"
+	}
+	if !to.After(from) {
+		errors["to"] = "The end of the range must be after its start"
+	}
+	return errors
+}
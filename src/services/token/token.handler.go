@@ -0,0 +1,201 @@
+package token
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lib/pq"
+)
+
+// personalAccessToken is a token as listed to its owner, the secret itself is only returned at creation
+type personalAccessToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type updateTokenRequest struct {
+	Name string `json:"name"`
+}
+
+const tokenColumns = "id, name, scopes, expires_at, last_used_at, created_at"
+
+func CreateTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateCreateTokenRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	secret, hash, err := account.NewToken()
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	row := database.DB.QueryRowContext(r.Context(), `INSERT INTO personal_access_token (username, name, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+tokenColumns,
+		r.Header.Get("Username"), req.Name, hash, pq.Array(req.Scopes), req.ExpiresAt)
+	t, err := scanToken(row)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":  t,
+		"secret": secret,
+	})
+}
+
+func GetTokensHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rows, err := database.DB.QueryContext(r.Context(), "SELECT "+tokenColumns+" FROM personal_access_token WHERE username = $1 ORDER BY id",
+		r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("failed to retrieve tokens", "error", err)
+		http.Error(w, "Failed to retrieve tokens", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []personalAccessToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan token", http.StatusInternalServerError)
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tokens": tokens,
+	})
+}
+
+func GetTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	row := database.DB.QueryRowContext(r.Context(), "SELECT "+tokenColumns+" FROM personal_access_token WHERE id = $1 AND username = $2",
+		id, r.Header.Get("Username"))
+	t, err := scanToken(row)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// UpdateTokenHandler renames a token. Scopes and expiry are fixed, a token with other ones has to be created instead.
+func UpdateTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req updateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateUpdateTokenRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	row := database.DB.QueryRowContext(r.Context(), "UPDATE personal_access_token SET name = $1 WHERE id = $2 AND username = $3 RETURNING "+tokenColumns,
+		req.Name, id, r.Header.Get("Username"))
+	t, err := scanToken(row)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// DeleteTokenHandler revokes a token, it stops working right away
+func DeleteTokenHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := database.DB.ExecContext(r.Context(), "DELETE FROM personal_access_token WHERE id = $1 AND username = $2", id, r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (personalAccessToken, error) {
+	var t personalAccessToken
+	err := row.Scan(&t.ID, &t.Name, pq.Array(&t.Scopes), &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	return t, err
+}
@@ -0,0 +1,37 @@
+package token
+
+import (
+	"be-golang-todo/src/helper/account"
+	"strings"
+	"time"
+)
+
+func validateCreateTokenRequest(req createTokenRequest) map[string]string {
+	errors := validateTokenName(req.Name)
+	if len(req.Scopes) == 0 {
+		errors["scopes"] = "At least one scope is required"
+	}
+	for _, scope := range req.Scopes {
+		if !account.IsValidScope(scope) {
+			errors["scopes"] = "Scopes must be among " + strings.Join(account.Scopes, ", ")
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		errors["expires_at"] = "Expiry must be in the future"
+	}
+	return errors
+}
+
+func validateUpdateTokenRequest(req updateTokenRequest) map[string]string {
+	return validateTokenName(req.Name)
+}
+
+func validateTokenName(name string) map[string]string {
+	errors := make(map[string]string)
+	if len(name) == 0 {
+		errors["name"] = "Name is required"
+	} else if len(name) > 100 {
+		errors["name"] = "Name must be at most 100 characters"
+	}
+	return errors
+}
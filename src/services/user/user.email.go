@@ -0,0 +1,183 @@
+package user
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/mailer"
+	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Purposes of the tokens in user_token
+const (
+	tokenEmailVerification = "email_verification"
+	tokenPasswordReset     = "password_reset"
+)
+
+// mailCooldown is the minimum time between two messages of the same kind to a user
+const mailCooldown = time.Minute
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// SendVerificationEmail mails a link verifying the address to the user. Only the id of the
+// signed token is stored, hashed, so that the link works once.
+func SendVerificationEmail(ctx context.Context, username string, email string) error {
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		return err
+	}
+	token, err := utils.GenerateEmailToken(username, email, id)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.ExecContext(ctx, "INSERT INTO user_token (username, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		username, tokenEmailVerification, utils.HashToken(id), time.Now().Add(24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	mailer.SendInBackground(mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm that this is your email address by opening the link below within 24 hours:\n\n%s\n\n"+
+			"If you did not add this address to an account, you can ignore this message.\n",
+			username, appURL("/verify-email", token)),
+	})
+	return nil
+}
+
+// VerifyEmailHandler marks the address a verification token was sent to as verified.
+// It fails when the address was changed since.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	username, email, id, err := utils.DecodeEmailToken(req.Token)
+	if err != nil {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	used, err := useToken(r.Context(), tx, tokenEmailVerification, utils.HashToken(id))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if used == "" {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	res, err := tx.ExecContext(r.Context(), `UPDATE "user" SET email_verified_at = $1 WHERE username = $2 AND lower(email) = lower($3)`,
+		time.Now(), username, email)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, err := res.RowsAffected(); err != nil || rowsAffected == 0 {
+		http.Error(w, "The email address was changed, request a new verification email", http.StatusConflict)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email address verified"})
+}
+
+// ResendVerificationEmailHandler sends a new verification email to the current address
+func ResendVerificationEmailHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	username := r.Header.Get("Username")
+
+	var email sql.NullString
+	var verifiedAt *time.Time
+	err := database.DB.QueryRowContext(r.Context(), `SELECT email, email_verified_at FROM "user" WHERE username = $1`, username).Scan(&email, &verifiedAt)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !email.Valid {
+		http.Error(w, "No email address is set", http.StatusNotFound)
+		return
+	}
+	if verifiedAt != nil {
+		http.Error(w, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	if !takeMailSlot(r.Context(), tokenEmailVerification, username) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "A verification email was sent recently", http.StatusTooManyRequests)
+		return
+	}
+	if err := SendVerificationEmail(r.Context(), username, email.String); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// useToken consumes an unexpired, unused token and returns its username, "" when there is none
+func useToken(ctx context.Context, tx *sql.Tx, purpose string, hash string) (string, error) {
+	var username string
+	err := tx.QueryRowContext(ctx, `UPDATE user_token SET used_at = $1
+		WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+		RETURNING username`, time.Now(), hash, purpose).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return username, err
+}
+
+// takeMailSlot returns false when a message of this kind was sent to the user within the cooldown.
+// Without Redis messages are not throttled.
+func takeMailSlot(ctx context.Context, purpose string, username string) bool {
+	ok, err := config.RDB.SetNX(ctx, "mail:"+purpose+":"+username, 1, mailCooldown).Result()
+	if err != nil {
+		slog.Error("mail cooldown check failed", "error", err)
+		return true
+	}
+	return ok
+}
+
+// appURL builds a link to the frontend carrying a token, from APP_BASE_URL
+func appURL(path string, token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:" + os.Getenv("PORT")
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
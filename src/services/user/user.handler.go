@@ -2,14 +2,20 @@ package user
 
 import (
 	"be-golang-todo/models"
+	"be-golang-todo/src/helper/audit"
 	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/lockout"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/password"
+	"be-golang-todo/src/helper/session"
 	"be-golang-todo/src/helper/utils"
+	"be-golang-todo/src/services/mfa"
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func CreateUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -31,25 +37,44 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 
 	// Check if username is already taken
 	var existingUser models.User
-	if err := database.DB.QueryRow("SELECT username FROM \"user\" WHERE username = $1", req.Username).Scan(&existingUser.Username); err != sql.ErrNoRows {
+	if err := database.DB.QueryRowContext(r.Context(), "SELECT username FROM \"user\" WHERE username = $1", req.Username).Scan(&existingUser.Username); err != sql.ErrNoRows {
 		http.Error(w, "Username is already taken", http.StatusConflict)
 		return
 	}
 
+	if req.Email != nil {
+		var taken bool
+		if err := database.DB.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM \"user\" WHERE lower(email) = lower($1))", req.Email).Scan(&taken); err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "Email is already in use", http.StatusConflict)
+			return
+		}
+	}
+
 	// Hash the password before storing it
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(*req.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
 	// Insert the new user into the database
-	_, err = database.DB.Exec("INSERT INTO \"user\" (username, password) VALUES ($1, $2)", req.Username, hashedPassword)
+	_, err = database.DB.ExecContext(r.Context(), "INSERT INTO \"user\" (username, password, email) VALUES ($1, $2, $3)", req.Username, hashedPassword, req.Email)
 	if err != nil {
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
+	// The account works without a verified address, a failed email can be sent again later
+	if req.Email != nil {
+		if err := SendVerificationEmail(r.Context(), *req.Username, *req.Email); err != nil {
+			logging.From(r).Error("verification email not sent", "error", err)
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "User created successfully"})
 }
@@ -72,26 +97,83 @@ func LoginUserHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		return
 	}
 
+	// Locked out usernames and addresses are refused before looking at the password,
+	// repeated failures slow down every further attempt
+	ip := utils.ClientIP(r)
+	status := lockout.Check(r.Context(), *req.Username, ip)
+	if status.RetryAfter > 0 {
+		w.Header().Set("Retry-After", lockout.RetryAfterSeconds(status.RetryAfter))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	time.Sleep(status.Delay())
+
 	// Retrieve the user from the database by username
 	var storedUser models.User
-	err := database.DB.QueryRow("SELECT id, username, password FROM \"user\" WHERE username = $1", req.Username).Scan(
-		&storedUser.ID, &storedUser.Username, &storedUser.Password)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
-		return
-	} else if err != nil {
+	err := database.DB.QueryRowContext(r.Context(), "SELECT id, username, password, role, disabled_at, totp_enabled_at FROM \"user\" WHERE username = $1", req.Username).Scan(
+		&storedUser.ID, &storedUser.Username, &storedUser.Password, &storedUser.Role, &storedUser.DisabledAt, &storedUser.TOTPEnabledAt)
+	if err != nil && err != sql.ErrNoRows {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	// Compare the provided password with the stored hashed password
-	if err := bcrypt.CompareHashAndPassword([]byte(*storedUser.Password), []byte(*req.Password)); err != nil {
+	// Compare the provided password with the stored hashed password. Unknown usernames
+	// go through the same comparison and counters so that they cannot be told apart.
+	hashedPassword := ""
+	if err == nil {
+		hashedPassword = *storedUser.Password
+	}
+	if !lockout.VerifyPassword(hashedPassword, *req.Password) {
+		locked, err := lockout.RecordFailure(r.Context(), *req.Username, ip)
+		if err != nil {
+			logging.From(r).Error("login failure not recorded", "error", err)
+		}
+		if locked {
+			audit.Record(r.Context(), "", audit.ActionLoginLocked, *req.Username, ip, audit.Details{"source": "login"})
+		}
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
+	if err := lockout.Reset(r.Context(), *req.Username); err != nil {
+		logging.From(r).Error("login failure reset failed", "error", err)
+	}
+
+	// Only checked once the password is known to be right, so that it does not reveal which accounts exist
+	if storedUser.DisabledAt != nil {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	// Hashes made with bcrypt or lower costs are upgraded while the password is at hand,
+	// unless it was changed in the meantime
+	if password.NeedsRehash(hashedPassword) {
+		if newHash, err := password.Hash(*req.Password); err != nil {
+			logging.From(r).Error("password rehash failed", "error", err)
+		} else if _, err := database.DB.ExecContext(r.Context(), "UPDATE \"user\" SET password = $1 WHERE username = $2 AND password = $3",
+			newHash, *storedUser.Username, hashedPassword); err != nil {
+			logging.From(r).Error("password rehash failed", "error", err)
+		}
+	}
+
+	// With two-factor authentication the password only earns a token for /login/mfa
+	if storedUser.TOTPEnabledAt != nil {
+		mfaToken, err := mfa.StartLogin(r.Context(), *storedUser.Username)
+		if err != nil {
+			logging.From(r).Error("failed to start two-factor login", "error", err)
+			http.Error(w, "Failed to start two-factor login", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
 
 	// Generate JWT
-	token, err := utils.GenerateToken(*req.Username)
+	token, err := session.Issue(r, *storedUser.Username, *storedUser.Role)
 	if err != nil {
 		http.Error(w, "Failed to generate JWT", http.StatusInternalServerError)
 		return
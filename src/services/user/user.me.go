@@ -0,0 +1,360 @@
+package user
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/helper/audit"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/lockout"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/password"
+	"be-golang-todo/src/helper/session"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// What happens to the tasks created by a user who deletes their account, from ACCOUNT_DELETION_TASKS
+const (
+	// Tasks are moved to the trash unless they are assigned to someone else, the default
+	deletionTasksUnshared = "unshared"
+	// Every task is moved to the trash
+	deletionTasksDelete = "delete"
+	// Tasks stay as they are
+	deletionTasksKeep = "keep"
+)
+
+type profile struct {
+	Username      string  `json:"username"`
+	DisplayName   *string `json:"display_name"`
+	Email         *string `json:"email"`
+	EmailVerified bool    `json:"email_verified"`
+	TimeZone      *string `json:"time_zone"`
+	Locale        *string `json:"locale"`
+	AvatarURL     *string `json:"avatar_url"`
+	Role          string  `json:"role"`
+	TOTPEnabled   bool    `json:"totp_enabled"`
+	HasPassword   bool    `json:"has_password"`
+}
+
+// updateProfileRequest holds the fields to change, an empty string clears a field
+type updateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+	TimeZone    *string `json:"time_zone"`
+	Locale      *string `json:"locale"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// deleteAccountRequest confirms a deletion with the password, or the username for
+// accounts that sign in through an identity provider and have none
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+	Confirm  string `json:"confirm"`
+}
+
+func GetMeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	p, err := loadProfile(r.Context(), r.Header.Get("Username"))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// UpdateMeHandler changes the profile. A new email address has to be verified again.
+func UpdateMeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req updateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateUpdateProfileRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	username := r.Header.Get("Username")
+	current, err := loadProfile(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	emailChanged := req.Email != nil && (current.Email == nil || !strings.EqualFold(*current.Email, *req.Email))
+	if emailChanged && *req.Email != "" {
+		var taken bool
+		if err := database.DB.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM \"user\" WHERE lower(email) = lower($1) AND username <> $2)", req.Email, username).Scan(&taken); err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "Email is already in use", http.StatusConflict)
+			return
+		}
+	}
+
+	var columns []string
+	var args []interface{}
+	set := func(column string, value *string) {
+		if value != nil {
+			args = append(args, *value)
+			columns = append(columns, fmt.Sprintf("%s = NULLIF($%d, '')", column, len(args)))
+		}
+	}
+	set("display_name", req.DisplayName)
+	set("time_zone", req.TimeZone)
+	set("locale", req.Locale)
+	set("avatar_url", req.AvatarURL)
+	if emailChanged {
+		set("email", req.Email)
+		columns = append(columns, "email_verified_at = NULL")
+	}
+
+	if len(columns) > 0 {
+		args = append(args, username)
+		query := fmt.Sprintf("UPDATE \"user\" SET %s WHERE username = $%d", strings.Join(columns, ", "), len(args))
+		if _, err := database.DB.ExecContext(r.Context(), query, args...); err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if emailChanged && *req.Email != "" {
+		if err := SendVerificationEmail(r.Context(), username, *req.Email); err != nil {
+			logging.From(r).Error("verification email not sent", "error", err)
+		}
+	}
+
+	p, err := loadProfile(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// ChangePasswordHandler sets a new password after checking the current one. Every session
+// ends, the response carries the token of a new session replacing the current one.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	username := r.Header.Get("Username")
+
+	// Validate the request data
+	errors := validateChangePasswordRequest(req, username)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	if !checkCurrentPassword(w, r, username, req.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := password.Hash(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(r.Context(), "UPDATE \"user\" SET password = $1 WHERE username = $2", hashedPassword, username)
+	if err == nil {
+		// Pending reset links were meant for the old password
+		_, err = tx.ExecContext(r.Context(), "UPDATE user_token SET used_at = $1 WHERE username = $2 AND purpose = $3 AND used_at IS NULL",
+			time.Now(), username, tokenPasswordReset)
+	}
+	if err == nil {
+		err = account.EndSessions(r.Context(), tx, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+	if err := session.RevokeAll(r.Context(), username); err != nil {
+		logging.From(r).Error("session revocation failed", "error", err)
+	}
+	audit.Record(r.Context(), username, audit.ActionPasswordChanged, username, utils.ClientIP(r), nil)
+
+	token, err := session.Issue(r, username, r.Header.Get("Role"))
+	if err != nil {
+		http.Error(w, "Failed to generate JWT", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password updated",
+		"token":   token,
+	})
+}
+
+// DeleteMeHandler soft deletes the account. The username stays reserved, everything that
+// signs in as the user is removed and the tasks they created follow ACCOUNT_DELETION_TASKS.
+func DeleteMeHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req deleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	username := r.Header.Get("Username")
+	p, err := loadProfile(r.Context(), username)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if p.HasPassword {
+		if !checkCurrentPassword(w, r, username, req.Password) {
+			return
+		}
+	} else if req.Confirm != username {
+		http.Error(w, "Confirm the deletion with your username", http.StatusBadRequest)
+		return
+	}
+
+	policy := taskDeletionPolicy()
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	switch policy {
+	case deletionTasksDelete:
+		_, err = tx.ExecContext(r.Context(), "UPDATE task SET deleted_at = $1 WHERE created_by = $2 AND deleted_at IS NULL", now, username)
+	case deletionTasksUnshared:
+		_, err = tx.ExecContext(r.Context(), `UPDATE task SET deleted_at = $1 WHERE created_by = $2 AND deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM task_assignee a WHERE a.task_id = task.id AND a.username <> $2)`, now, username)
+	}
+	if err == nil {
+		err = account.Tombstone(r.Context(), tx, username)
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+	if err := session.RevokeAll(r.Context(), username); err != nil {
+		logging.From(r).Error("session revocation failed", "error", err)
+	}
+	audit.Record(r.Context(), username, audit.ActionUserDeleted, username, utils.ClientIP(r), audit.Details{"self": true, "tasks": policy})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadProfile(ctx context.Context, username string) (profile, error) {
+	p := profile{Username: username}
+	var emailVerifiedAt, totpEnabledAt *time.Time
+	err := database.DB.QueryRowContext(ctx, `SELECT display_name, email, email_verified_at, time_zone, locale, avatar_url, role,
+		totp_enabled_at, COALESCE(password, '') <> '' FROM "user" WHERE username = $1`, username).Scan(
+		&p.DisplayName, &p.Email, &emailVerifiedAt, &p.TimeZone, &p.Locale, &p.AvatarURL, &p.Role, &totpEnabledAt, &p.HasPassword)
+	p.EmailVerified = emailVerifiedAt != nil
+	p.TOTPEnabled = totpEnabledAt != nil
+	return p, err
+}
+
+// checkCurrentPassword writes the error response and returns false unless the password is
+// right. A stolen session cannot be used to guess it, failures count towards the lockout.
+func checkCurrentPassword(w http.ResponseWriter, r *http.Request, username string, password string) bool {
+	ip := utils.ClientIP(r)
+	status := lockout.Check(r.Context(), username, ip)
+	if status.RetryAfter > 0 {
+		w.Header().Set("Retry-After", lockout.RetryAfterSeconds(status.RetryAfter))
+		http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	var hashedPassword sql.NullString
+	if err := database.DB.QueryRowContext(r.Context(), "SELECT password FROM \"user\" WHERE username = $1", username).Scan(&hashedPassword); err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return false
+	}
+	// Accounts created through an identity provider have no password to check yet
+	if hashedPassword.String == "" {
+		return true
+	}
+
+	if !lockout.VerifyPassword(hashedPassword.String, password) {
+		locked, err := lockout.RecordFailure(r.Context(), username, ip)
+		if err != nil {
+			logging.From(r).Error("login failure not recorded", "error", err)
+		}
+		if locked {
+			audit.Record(r.Context(), "", audit.ActionLoginLocked, username, ip, audit.Details{"source": "password_check"})
+		}
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func taskDeletionPolicy() string {
+	switch policy := os.Getenv("ACCOUNT_DELETION_TASKS"); policy {
+	case deletionTasksDelete, deletionTasksKeep:
+		return policy
+	default:
+		return deletionTasksUnshared
+	}
+}
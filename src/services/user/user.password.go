@@ -0,0 +1,193 @@
+package user
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/helper/audit"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/lockout"
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/mailer"
+	"be-golang-todo/src/helper/password"
+	"be-golang-todo/src/helper/session"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// passwordResetLifetime is how long a password reset link stays valid
+const passwordResetLifetime = time.Hour
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ForgotPasswordHandler mails a password reset link to a verified address. The response is
+// the same whether or not the address belongs to an account.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateForgotPasswordRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	var username, email string
+	err := database.DB.QueryRowContext(r.Context(), `SELECT username, email FROM "user"
+		WHERE lower(email) = lower($1) AND email_verified_at IS NOT NULL AND disabled_at IS NULL`, req.Email).Scan(&username, &email)
+	if err != nil && err != sql.ErrNoRows {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && takeMailSlot(r.Context(), tokenPasswordReset, username) {
+		if err := sendPasswordResetEmail(r.Context(), username, email); err != nil {
+			logging.From(r).Error("database error", "error", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the address belongs to a verified account, a reset link was sent to it",
+	})
+}
+
+// ResetPasswordHandler sets a new password with a token from a reset email. Every other
+// reset link of the user and every session stop working.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the request data
+	errors := validateResetPasswordRequest(req)
+	if len(errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": errors,
+		})
+		return
+	}
+
+	tx, err := database.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	username, err := useToken(r.Context(), tx, tokenPasswordReset, utils.HashToken(req.Token))
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	// Checked once the username is known, the token stays usable when the password is refused
+	if violations := password.Default.Check(req.Password, username); len(violations) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": map[string]interface{}{"password": violations},
+		})
+		return
+	}
+
+	hashedPassword, err := password.Hash(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	var email string
+	err = tx.QueryRowContext(r.Context(), `UPDATE "user" SET password = $1 WHERE username = $2 AND disabled_at IS NULL RETURNING email`,
+		hashedPassword, username).Scan(&email)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "UPDATE user_token SET used_at = $1 WHERE username = $2 AND purpose = $3 AND used_at IS NULL",
+			time.Now(), username, tokenPasswordReset)
+	}
+	if err == nil {
+		err = account.EndSessions(r.Context(), tx, username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := account.Invalidate(r.Context(), username); err != nil {
+		logging.From(r).Error("account cache invalidation failed", "error", err)
+	}
+
+	if err := session.RevokeAll(r.Context(), username); err != nil {
+		logging.From(r).Error("session revocation failed", "error", err)
+	}
+	if err := lockout.Reset(r.Context(), username); err != nil {
+		logging.From(r).Error("login failure reset failed", "error", err)
+	}
+	audit.Record(r.Context(), username, audit.ActionPasswordReset, username, utils.ClientIP(r), audit.Details{"source": "email"})
+	mailer.SendInBackground(mailer.Message{
+		To:      email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nthe password of your account was just reset. "+
+			"If this was not you, contact an administrator.\n", username),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated"})
+}
+
+// sendPasswordResetEmail mails a random reset token, which is stored hashed
+func sendPasswordResetEmail(ctx context.Context, username string, email string) error {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.ExecContext(ctx, "INSERT INTO user_token (username, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)",
+		username, tokenPasswordReset, utils.HashToken(token), time.Now().Add(passwordResetLifetime))
+	if err != nil {
+		return err
+	}
+
+	mailer.SendInBackground(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nset a new password by opening the link below within an hour:\n\n%s\n\n"+
+			"If you did not ask for this, you can ignore this message, your password stays the same.\n",
+			username, appURL("/reset-password", token)),
+	})
+	return nil
+}
@@ -0,0 +1,48 @@
+package user
+
+import (
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/helper/session"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// GetSessionsHandler lists the devices logged in to the account, marking the one making the request
+func GetSessionsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	sessions, err := session.List(r.Context(), r.Header.Get("Username"), r.Header.Get("Session-Id"))
+	if err != nil {
+		logging.From(r).Error("failed to retrieve sessions", "error", err)
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// RevokeSessionHandler logs a device out, revoking the current session logs out
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := session.Revoke(r.Context(), r.Header.Get("Username"), id)
+	if err != nil {
+		logging.From(r).Error("database error", "error", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
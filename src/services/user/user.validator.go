@@ -2,10 +2,16 @@ package user
 
 import (
 	"be-golang-todo/models"
+	"be-golang-todo/src/helper/password"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"golang.org/x/text/language"
 )
 
-func validateCreateUserRequest(req models.User) map[string]string {
-	errors := make(map[string]string)
+func validateCreateUserRequest(req models.User) map[string]interface{} {
+	errors := make(map[string]interface{})
 	if len(*req.Username) == 0 {
 		errors["username"] = "Username is required"
 	} else if len(*req.Username) < 5 || len(*req.Username) > 20 {
@@ -13,8 +19,11 @@ func validateCreateUserRequest(req models.User) map[string]string {
 	}
 	if len(*req.Password) == 0 {
 		errors["password"] = "password is required"
-	} else if len(*req.Username) < 5 || len(*req.Password) > 20 {
-		errors["password"] = "Password must be between 5 and 20 characters"
+	} else if violations := password.Default.Check(*req.Password, *req.Username); len(violations) > 0 {
+		errors["password"] = violations
+	}
+	if req.Email != nil && !isValidEmail(*req.Email) {
+		errors["email"] = "Email must be a valid address"
 	}
 	return errors
 }
@@ -29,3 +38,66 @@ func validateLoginRequest(req models.User) map[string]string {
 	}
 	return errors
 }
+
+func validateForgotPasswordRequest(req forgotPasswordRequest) map[string]string {
+	errors := make(map[string]string)
+	if len(req.Email) == 0 {
+		errors["email"] = "Email is required"
+	}
+	return errors
+}
+
+func validateResetPasswordRequest(req resetPasswordRequest) map[string]string {
+	errors := make(map[string]string)
+	if len(req.Token) == 0 {
+		errors["token"] = "Token is required"
+	}
+	if len(req.Password) == 0 {
+		errors["password"] = "password is required"
+	}
+	return errors
+}
+
+// isValidEmail accepts a bare address, without a display name
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && len(email) <= 254
+}
+
+func validateUpdateProfileRequest(req updateProfileRequest) map[string]string {
+	errors := make(map[string]string)
+	if req.DisplayName != nil && len(*req.DisplayName) > 64 {
+		errors["display_name"] = "Display name must be at most 64 characters"
+	}
+	if req.Email != nil && *req.Email != "" && !isValidEmail(*req.Email) {
+		errors["email"] = "Email must be a valid address"
+	}
+	if req.TimeZone != nil && *req.TimeZone != "" {
+		// LoadLocation also accepts "Local" and paths, only IANA names are meaningful to other clients
+		if _, err := time.LoadLocation(*req.TimeZone); err != nil || *req.TimeZone == "Local" {
+			errors["time_zone"] = "Time zone must be an IANA time zone name"
+		}
+	}
+	if req.Locale != nil && *req.Locale != "" {
+		if _, err := language.Parse(*req.Locale); err != nil || len(*req.Locale) > 35 {
+			errors["locale"] = "Locale must be a BCP 47 language tag"
+		}
+	}
+	if req.AvatarURL != nil && *req.AvatarURL != "" {
+		u, err := url.Parse(*req.AvatarURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(*req.AvatarURL) > 2048 {
+			errors["avatar_url"] = "Avatar must be an http or https URL"
+		}
+	}
+	return errors
+}
+
+func validateChangePasswordRequest(req changePasswordRequest, username string) map[string]interface{} {
+	errors := make(map[string]interface{})
+	if len(req.NewPassword) == 0 {
+		errors["new_password"] = "New password is required"
+	} else if violations := password.Default.Check(req.NewPassword, username); len(violations) > 0 {
+		errors["new_password"] = violations
+	}
+	return errors
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/services/attachment"
+	"be-golang-todo/src/services/comment"
+	"be-golang-todo/src/services/timeentry"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestTaskServicesRequireAccess(t *testing.T) {
+	useTestDatabase(t)
+	useTestRedis(t)
+	owner := createTestUser(t, account.RoleUser)
+	assignee := createTestUser(t, account.RoleUser)
+	stranger := createTestUser(t, account.RoleUser)
+	id := createTestTask(t, &owner)
+	if _, err := database.DB.Exec("INSERT INTO task_assignee (task_id, username, assigned_by) VALUES ($1, $2, $3)", id, assignee, owner); err != nil {
+		t.Fatal(err)
+	}
+	ps := httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}}
+	url := "/tasks/" + strconv.Itoa(id)
+
+	handlers := map[string]httprouter.Handle{
+		"GET comments":     comment.GetTaskCommentsHandler,
+		"GET attachments":  attachment.GetTaskAttachmentsHandler,
+		"GET time entries": timeentry.GetTaskTimeEntriesHandler,
+	}
+	for name, handle := range handlers {
+		for _, username := range []string{owner, assignee} {
+			w := httptest.NewRecorder()
+			handle(w, asUser(httptest.NewRequest("GET", url, nil), username, account.RoleUser), ps)
+			if w.Code != http.StatusOK {
+				t.Errorf("%s as %s: status %d, want %d", name, username, w.Code, http.StatusOK)
+			}
+		}
+		w := httptest.NewRecorder()
+		handle(w, asUser(httptest.NewRequest("GET", url, nil), stranger, account.RoleUser), ps)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s as a stranger: status %d, want %d", name, w.Code, http.StatusForbidden)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	comment.CreateCommentHandler(w, asUser(httptest.NewRequest("POST", url+"/comments", strings.NewReader(`{"body": "hello"}`)), stranger, account.RoleUser), ps)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("a stranger commented: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = httptest.NewRecorder()
+	timeentry.StartTimerHandler(w, asUser(httptest.NewRequest("POST", url+"/timer/start", nil), stranger, account.RoleUser), ps)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("a stranger started a timer: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// A deleted task is gone for everyone
+	if _, err := database.DB.Exec("UPDATE task SET deleted_at = now() WHERE id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	comment.GetTaskCommentsHandler(w, asUser(httptest.NewRequest("GET", url, nil), owner, account.RoleUser), ps)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET comments of a deleted task: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/middlewares"
+	"be-golang-todo/src/services/admin"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRequireRole(t *testing.T) {
+	var called bool
+	handle := middlewares.RequireRole(account.RoleAdmin, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	cases := map[string]int{
+		account.RoleAdmin: http.StatusNoContent,
+		account.RoleUser:  http.StatusForbidden,
+		"":                http.StatusForbidden,
+		"Admin":           http.StatusForbidden,
+	}
+	for role, want := range cases {
+		called = false
+		w := httptest.NewRecorder()
+		handle(w, asUser(httptest.NewRequest("GET", "/admin/users", nil), "someone", role), nil)
+		if w.Code != want {
+			t.Errorf("role %q: status %d, want %d", role, w.Code, want)
+		}
+		if called != (want == http.StatusNoContent) {
+			t.Errorf("role %q: handler called %v", role, called)
+		}
+	}
+}
+
+func TestAdminCannotActOnOwnAccount(t *testing.T) {
+	useTestDatabase(t)
+	useTestRedis(t)
+	adminName := createTestUser(t, account.RoleAdmin)
+	other := createTestUser(t, account.RoleUser)
+
+	userID := func(username string) string {
+		t.Helper()
+		var id int
+		if err := database.DB.QueryRow(`SELECT id FROM "user" WHERE username = $1`, username).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return strconv.Itoa(id)
+	}
+	disable := func(id string) int {
+		w := httptest.NewRecorder()
+		admin.DisableUserHandler(w, asUser(httptest.NewRequest("POST", "/admin/users/"+id+"/disable", nil), adminName, account.RoleAdmin),
+			httprouter.Params{{Key: "id", Value: id}})
+		return w.Code
+	}
+	remove := func(id string) int {
+		w := httptest.NewRecorder()
+		admin.DeleteUserHandler(w, asUser(httptest.NewRequest("DELETE", "/admin/users/"+id, nil), adminName, account.RoleAdmin),
+			httprouter.Params{{Key: "id", Value: id}})
+		return w.Code
+	}
+
+	if code := disable(userID(adminName)); code != http.StatusConflict {
+		t.Errorf("disable own account: status %d, want %d", code, http.StatusConflict)
+	}
+	if code := remove(userID(adminName)); code != http.StatusConflict {
+		t.Errorf("delete own account: status %d, want %d", code, http.StatusConflict)
+	}
+	var disabled bool
+	if err := database.DB.QueryRow(`SELECT disabled_at IS NOT NULL FROM "user" WHERE username = $1`, adminName).Scan(&disabled); err != nil {
+		t.Fatal(err)
+	}
+	if disabled {
+		t.Error("the admin disabled their own account")
+	}
+
+	if code := disable(userID(other)); code != http.StatusNoContent {
+		t.Errorf("disable another account: status %d, want %d", code, http.StatusNoContent)
+	}
+	if code := disable("0"); code != http.StatusNotFound {
+		t.Errorf("disable a missing account: status %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/services/caldav"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	gocaldav "github.com/emersion/go-webdav/caldav"
+)
+
+func newTodo(uid string, summary string) *ical.Calendar {
+	todo := ical.NewComponent(ical.CompToDo)
+	todo.Props.SetText(ical.PropUID, uid)
+	todo.Props.SetText(ical.PropSummary, summary)
+	todo.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//be-golang-todo//test//EN")
+	cal.Children = append(cal.Children, todo)
+	return cal
+}
+
+// putTodo sends a PUT with an If-Match header, which the client library does not set,
+// and returns the status
+func putTodo(client webdav.HTTPClient, url string, ifMatch string, cal *ical.Calendar) (int, error) {
+	var body bytes.Buffer
+	if err := ical.NewEncoder(&body).Encode(cal); err != nil {
+		return 0, err
+	}
+	r, err := http.NewRequest("PUT", url, &body)
+	if err != nil {
+		return 0, err
+	}
+	r.Header.Set("Content-Type", ical.MIMEType)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestCalDAVClient(t *testing.T) {
+	useTestDatabase(t)
+	useTestRedis(t)
+	username := createTestUser(t, account.RoleUser)
+	const secret = "correct horse battery staple"
+	setTestPassword(t, username, secret)
+
+	server := httptest.NewServer(caldav.Handler())
+	defer server.Close()
+	httpClient := webdav.HTTPClientWithBasicAuth(server.Client(), username, secret)
+	client, err := gocaldav.NewClient(httpClient, server.URL+caldav.Prefix+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	principal, err := client.FindCurrentUserPrincipal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	homeSet, err := client.FindCalendarHomeSet(ctx, principal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendars, err := client.FindCalendars(ctx, homeSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendars) != 1 {
+		t.Fatalf("found %d calendars, want 1", len(calendars))
+	}
+	collection := calendars[0].Path
+
+	// A new resource becomes a task, listed with its ETag
+	created, err := client.PutCalendarObject(ctx, collection+"groceries.ics", newTodo("groceries-uid", "Buy milk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ETag == "" {
+		t.Fatal("the created resource has no ETag")
+	}
+	objects, err := client.QueryCalendar(ctx, collection, &gocaldav.CalendarQuery{
+		CompRequest: gocaldav.CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+		CompFilter:  gocaldav.CompFilter{Name: "VCALENDAR", Comps: []gocaldav.CompFilter{{Name: "VTODO"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Path != collection+"groceries.ics" {
+		t.Fatalf("the calendar holds %v, want groceries.ics alone", objects)
+	}
+	summary, _ := objects[0].Data.Children[0].Props.Text(ical.PropSummary)
+	if summary != "Buy milk" {
+		t.Errorf("SUMMARY %q, want %q", summary, "Buy milk")
+	}
+
+	// A write based on the current ETag goes through, one based on an older one fails
+	url := server.URL + collection + "groceries.ics"
+	if status, err := putTodo(httpClient, url, `"`+created.ETag+`"`, newTodo("groceries-uid", "Buy oat milk")); err != nil || status >= 300 {
+		t.Fatalf("PUT with the current ETag: status %d, %v", status, err)
+	}
+	if status, err := putTodo(httpClient, url, `"`+created.ETag+`"`, newTodo("groceries-uid", "Buy soy milk")); err != nil || status != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale ETag: status %d, %v, want %d", status, err, http.StatusPreconditionFailed)
+	}
+	object, err := client.GetCalendarObject(ctx, collection+"groceries.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary, _ := object.Data.Children[0].Props.Text(ical.PropSummary); summary != "Buy oat milk" {
+		t.Errorf("SUMMARY %q after the stale write, want %q", summary, "Buy oat milk")
+	}
+
+	// Clients putting the same new resource at once create a single task
+	var wg sync.WaitGroup
+	statuses := make([]int, 5)
+	for i := range statuses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i], _ = putTodo(httpClient, server.URL+collection+"race.ics", "", newTodo("race-uid", "Race"))
+		}()
+	}
+	wg.Wait()
+	for _, status := range statuses {
+		if status >= 300 && status != http.StatusPreconditionFailed {
+			t.Errorf("a concurrent PUT failed with status %d", status)
+		}
+	}
+	var count int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM task WHERE created_by = $1 AND caldav_name = 'race.ics' AND deleted_at IS NULL",
+		username).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("concurrent PUTs created %d tasks, want 1", count)
+	}
+
+	if err := client.RemoveAll(ctx, collection+"groceries.ics"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetCalendarObject(ctx, collection+"groceries.ics"); err == nil {
+		t.Error("the deleted resource is still there")
+	}
+}
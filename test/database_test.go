@@ -0,0 +1,106 @@
+package test
+
+import (
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/password"
+	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/utils"
+	"database/sql"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+)
+
+// useTestDatabase points database.DB at TEST_DATABASE_URL, a database with the schema and every
+// migration applied, for the duration of the test. Without it the test is skipped.
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		db.Close()
+		database.DB = previous
+	})
+}
+
+// useTestRedis points config.RDB at TEST_REDIS_ADDR for the duration of the test. Without it
+// Redis is unreachable, so caches always miss, which handlers that only cache get by with.
+func useTestRedis(t *testing.T) {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:1"
+	}
+	previous := config.RDB
+	config.RDB = redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1})
+	t.Cleanup(func() {
+		config.RDB.Close()
+		config.RDB = previous
+	})
+}
+
+// createTestUser registers a user with a fresh name and the given role. The user and
+// the tasks they created are removed once the test is over.
+func createTestUser(t *testing.T, role string) string {
+	t.Helper()
+	suffix, _ := utils.RandomToken(6)
+	username := "test_" + suffix
+	if _, err := database.DB.Exec(`INSERT INTO "user" (username, password, role) VALUES ($1, '', $2)`, username, role); err != nil {
+		t.Fatal(err)
+	}
+
+	db := database.DB
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM task WHERE created_by = $1", username)
+		db.Exec(`DELETE FROM "user" WHERE username = $1`, username)
+	})
+	return username
+}
+
+// setTestPassword gives a test user a password to sign in or confirm changes with
+func setTestPassword(t *testing.T, username string, secret string) {
+	t.Helper()
+	hash, err := password.Hash(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(`UPDATE "user" SET password = $1 WHERE username = $2`, hash, username); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestTask inserts a pending task created by the given user, nil for a task predating created_by
+func createTestTask(t *testing.T, createdBy *string) int {
+	t.Helper()
+	var id int
+	if err := database.DB.QueryRow("INSERT INTO task (title, description, created_by) VALUES ('test task', '', $1) RETURNING id", createdBy).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM task WHERE id = $1", id)
+	})
+	return id
+}
+
+// asUser marks a request as authenticated, the way ProtectedHandler does
+func asUser(r *http.Request, username string, role string) *http.Request {
+	r.Header.Set("Username", username)
+	r.Header.Set("Role", role)
+	return r
+}
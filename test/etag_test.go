@@ -0,0 +1,161 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/etag"
+	"be-golang-todo/src/services/task"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	cases := map[string]etag.IfMatch{
+		``:              {},
+		`"3"`:           {Present: true, Versions: []int{3}},
+		` "3" , "5" `:   {Present: true, Versions: []int{3, 5}},
+		`*`:             {Present: true, Any: true},
+		`W/"3"`:         {Present: true},
+		`3`:             {Present: true},
+		`"three", "4"`:  {Present: true, Versions: []int{4}},
+		`"", "x", "7"`:  {Present: true, Versions: []int{7}},
+		`W/"2", *, "9"`: {Present: true, Any: true, Versions: []int{9}},
+	}
+	for header, want := range cases {
+		r := httptest.NewRequest("PUT", "/tasks/1", nil)
+		r.Header.Set("If-Match", header)
+		if got := etag.ParseIfMatch(r); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseIfMatch(%q) = %+v, want %+v", header, got, want)
+		}
+	}
+}
+
+func TestIfMatchMatches(t *testing.T) {
+	if !(etag.IfMatch{Present: true, Any: true}).Matches(7) {
+		t.Error("* did not match")
+	}
+	if !(etag.IfMatch{Present: true, Versions: []int{6, 7}}).Matches(7) {
+		t.Error("a listed version did not match")
+	}
+	if (etag.IfMatch{Present: true, Versions: []int{6}}).Matches(7) {
+		t.Error("a stale version matched")
+	}
+	// Only weak or malformed tags were sent
+	if (etag.IfMatch{Present: true}).Matches(7) {
+		t.Error("a header without a usable tag matched")
+	}
+
+	if clause, args := (etag.IfMatch{Present: true, Any: true}).Clause(3); clause != "" || args != nil {
+		t.Errorf("* gave the clause %q", clause)
+	}
+	if clause, args := (etag.IfMatch{Present: true, Versions: []int{6}}).Clause(3); clause != " AND version = ANY($3)" || len(args) != 1 {
+		t.Errorf("Clause(3) = %q, %v", clause, args)
+	}
+	if clause, _ := (etag.IfMatch{Present: true}).Clause(3); clause == "" {
+		t.Error("a header without a usable tag gave no clause, the write would be unconditional")
+	}
+}
+
+func TestNoneMatch(t *testing.T) {
+	cases := map[string]bool{
+		``:           false,
+		`"7"`:        true,
+		`W/"7"`:      true,
+		`"6", W/"7"`: true,
+		`"6"`:        false,
+		`*`:          true,
+		`7`:          false,
+		`"07x"`:      false,
+	}
+	for header, want := range cases {
+		r := httptest.NewRequest("GET", "/tasks/1", nil)
+		r.Header.Set("If-None-Match", header)
+		if got := etag.NoneMatch(r, 7); got != want {
+			t.Errorf("NoneMatch(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestTaskPreconditions(t *testing.T) {
+	useTestDatabase(t)
+	owner := createTestUser(t, account.RoleUser)
+	id := createTestTask(t, &owner)
+	ps := httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}}
+
+	var version int
+	if err := database.DB.QueryRow("SELECT version FROM task WHERE id = $1", id).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	current := etag.Format(version)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := asUser(httptest.NewRequest("GET", "/tasks/"+strconv.Itoa(id), nil), owner, account.RoleUser)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		task.GetDetailTaskHandler(w, r, ps)
+		return w
+	}
+	patch := func(ifMatch string) *httptest.ResponseRecorder {
+		r := asUser(httptest.NewRequest("PATCH", "/tasks/"+strconv.Itoa(id), strings.NewReader(`{"Status": "in_progress"}`)), owner, account.RoleUser)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		task.UpdateTaskHandler(w, r, ps)
+		return w
+	}
+	remove := func(ifMatch string) *httptest.ResponseRecorder {
+		r := asUser(httptest.NewRequest("DELETE", "/tasks/"+strconv.Itoa(id), nil), owner, account.RoleUser)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		task.DeleteTaskHandler(w, r, ps)
+		return w
+	}
+
+	if w := get(""); w.Code != http.StatusOK || w.Header().Get("ETag") != current {
+		t.Fatalf("GET: status %d, ETag %q, want 200 and %q", w.Code, w.Header().Get("ETag"), current)
+	}
+	if w := get(current); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("GET with the current ETag: status %d, want %d without a body", w.Code, http.StatusNotModified)
+	}
+
+	if w := patch(""); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("PATCH without If-Match: status %d, want %d", w.Code, http.StatusPreconditionRequired)
+	}
+	if w := remove(""); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("DELETE without If-Match: status %d, want %d", w.Code, http.StatusPreconditionRequired)
+	}
+
+	w := patch(current)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH with the current ETag: status %d, %s", w.Code, w.Body.String())
+	}
+	next := w.Header().Get("ETag")
+	if next == current {
+		t.Error("the ETag did not change with the task")
+	}
+
+	// The first ETag is stale now
+	if w := patch(current); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with a stale ETag: status %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	if w := get(current); w.Code != http.StatusOK {
+		t.Errorf("GET with a stale ETag: status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := remove(current); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a stale ETag: status %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	if w := remove(next); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE with the current ETag: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/ical"
+	"be-golang-todo/src/services/calendar"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICalEncodeDecode(t *testing.T) {
+	due := time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC)
+	cal := ical.NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Components = append(cal.Components, calendar.TaskComponent(calendar.Task{
+		ID:          7,
+		Title:       "Write report; part 1, draft",
+		Description: strings.Repeat("long line with ünïcödé ", 10) + "\nsecond line",
+		Status:      "in_progress",
+		Priority:    "P1",
+		DueDate:     &due,
+	}, false, time.Now()))
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+
+	decoded, err := ical.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Components) != 1 {
+		t.Fatalf("expected 1 component, got %d", len(decoded.Components))
+	}
+
+	task, err := calendar.TaskFromComponent(decoded.Components[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Title != "Write report; part 1, draft" {
+		t.Errorf("unexpected title %q", task.Title)
+	}
+	if !strings.HasSuffix(task.Description, "\nsecond line") {
+		t.Errorf("description was not preserved: %q", task.Description)
+	}
+	if task.Status != "in_progress" || task.Priority != "P1" {
+		t.Errorf("unexpected status or priority: %s %s", task.Status, task.Priority)
+	}
+	if task.DueDate == nil || !task.DueDate.Equal(due) {
+		t.Errorf("unexpected due date %v", task.DueDate)
+	}
+}
+
+func TestICalParseTimeWithTZID(t *testing.T) {
+	component, err := ical.Decode(strings.NewReader("BEGIN:VTODO\r\nDUE;TZID=Asia/Jakarta:20240501T090000\r\nEND:VTODO\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, dateOnly, err := ical.ParseTime(component.Get("DUE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dateOnly || !due.Equal(time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected due date %v (date only %v)", due, dateOnly)
+	}
+}
+
+func TestICalAllDayDueDates(t *testing.T) {
+	due := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Midnight is a time like any other unless the task is marked as a whole day
+	timed := calendar.TaskComponent(calendar.Task{ID: 1, Title: "timed", DueDate: &due}, false, time.Now())
+	if p := timed.Get("DUE"); p == nil || p.Params["VALUE"] == "DATE" || p.Value != "20240501T000000Z" {
+		t.Errorf("unexpected DUE for a timed task: %+v", p)
+	}
+
+	allDay := calendar.TaskComponent(calendar.Task{ID: 2, Title: "all day", DueDate: &due, DueAllDay: true}, false, time.Now())
+	if p := allDay.Get("DUE"); p == nil || p.Params["VALUE"] != "DATE" || p.Value != "20240501" {
+		t.Errorf("unexpected DUE for an all day task: %+v", p)
+	}
+	event := calendar.TaskComponent(calendar.Task{ID: 2, Title: "all day", DueDate: &due, DueAllDay: true}, true, time.Now())
+	if p := event.Get("DTEND"); p == nil || p.Params["VALUE"] != "DATE" || p.Value != "20240502" {
+		t.Errorf("unexpected DTEND for an all day event: %+v", p)
+	}
+
+	task, err := calendar.TaskFromComponent(allDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !task.DueAllDay || task.DueDate == nil || !task.DueDate.Equal(due) {
+		t.Errorf("all day due date not read back: %v %v", task.DueDate, task.DueAllDay)
+	}
+	if task, _ := calendar.TaskFromComponent(timed); task.DueAllDay {
+		t.Error("a timed due date was read as a whole day")
+	}
+}
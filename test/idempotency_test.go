@@ -0,0 +1,32 @@
+package test
+
+import (
+	"be-golang-todo/src/middlewares"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestIdempotentRejectsLargeBodies(t *testing.T) {
+	t.Setenv("ATTACHMENT_MAX_BYTES", "1024")
+	called := false
+	handler := middlewares.Idempotent(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		called = true
+	})
+
+	r := httptest.NewRequest("POST", "/tasks", bytes.NewReader(make([]byte, 10<<20+1)))
+	r.Header.Set("Idempotency-Key", "large")
+	r.Header.Set("Username", "alice")
+	w := httptest.NewRecorder()
+	handler(w, r, nil)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if called {
+		t.Error("the handler ran")
+	}
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"be-golang-todo/src/services/task"
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImportRejectsLargeFiles(t *testing.T) {
+	huge := strings.Repeat("x", 10<<20)
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "tasks.csv")
+	part.Write([]byte("title\n" + huge + "\n"))
+	writer.Close()
+
+	cases := []struct {
+		name        string
+		format      string
+		contentType string
+		body        []byte
+	}{
+		{"json", "json", "application/json", []byte(`[{"title": "` + huge + `"}]`)},
+		{"csv", "csv", "text/csv", []byte("title\n" + huge + "\n")},
+		{"trello", "trello", "application/json", []byte(`{"name": "` + huge + `"}`)},
+		{"multipart csv", "csv", writer.FormDataContentType(), form.Bytes()},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/tasks/import?format="+c.format, bytes.NewReader(c.body))
+		r.Header.Set("Content-Type", c.contentType)
+		r.Header.Set("Username", "alice")
+		w := httptest.NewRecorder()
+		task.ImportTasksHandler(w, r, nil)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d, want 413: %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/lockout"
+	"testing"
+	"time"
+)
+
+func TestLockoutDelayIsProgressive(t *testing.T) {
+	if d := (lockout.Status{}).Delay(); d != 0 {
+		t.Errorf("no failures: delay %v, want 0", d)
+	}
+
+	previous := time.Duration(0)
+	for failures := 1; failures < 100; failures++ {
+		d := lockout.Status{Failures: failures}.Delay()
+		if d < previous {
+			t.Fatalf("%d failures: delay %v shorter than %v", failures, d, previous)
+		}
+		if d > 4*time.Second {
+			t.Fatalf("%d failures: delay %v above the cap", failures, d)
+		}
+		previous = d
+	}
+}
+
+func TestRetryAfterSecondsRoundsUp(t *testing.T) {
+	cases := map[time.Duration]string{
+		time.Second:             "1",
+		1500 * time.Millisecond: "2",
+		15 * time.Minute:        "900",
+	}
+	for d, want := range cases {
+		if got := lockout.RetryAfterSeconds(d); got != want {
+			t.Errorf("RetryAfterSeconds(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestVerifyPasswordUnknownUser(t *testing.T) {
+	if lockout.VerifyPassword("", "anything") {
+		t.Error("an empty hash must never verify")
+	}
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/logging"
+	"be-golang-todo/src/middlewares"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRoutePattern(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {}
+	router := httprouter.New()
+	router.GET("/tasks/:id", noop)
+	router.GET("/tasks/:id/comments/:comment_id", noop)
+	router.GET("/users/:name/tasks", noop)
+	router.GET("/dav/*path", noop)
+
+	cases := map[string]string{
+		"/tasks/12":              "/tasks/:id",
+		"/tasks/tasks":           "/tasks/:id",
+		"/tasks/7/comments/7":    "/tasks/:id/comments/:comment_id",
+		"/users/tasks/tasks":     "/users/:name/tasks",
+		"/dav/alice/tasks/1.ics": "/dav/*path",
+		"/unknown":               "",
+	}
+	for path, want := range cases {
+		if got := middlewares.RoutePattern(router, "GET", path); got != want {
+			t.Errorf("RoutePattern(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	router := httprouter.New()
+	router.GET("/tasks/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		logging.With(r, "user", "alice")
+		logging.From(r).Info("inside")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := middlewares.AccessLog(router)
+
+	r := httptest.NewRequest("GET", "/tasks/5", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("X-Request-ID = %q, want the one sent", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var inside, access map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &inside)
+	json.Unmarshal([]byte(lines[1]), &access)
+	if inside["request_id"] != "abc-123" {
+		t.Errorf("handler line lacks the request ID: %s", lines[0])
+	}
+	if access["route"] != "/tasks/:id" || access["status"] != float64(http.StatusTeapot) ||
+		access["user"] != "alice" || access["request_id"] != "abc-123" {
+		t.Errorf("unexpected access line: %s", lines[1])
+	}
+
+	// An unusable ID from the client is replaced
+	r = httptest.NewRequest("GET", "/tasks/5", nil)
+	r.Header.Set("X-Request-ID", "bad id\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Request-ID"); got == "" || got == "bad id\n" {
+		t.Errorf("X-Request-ID = %q, want a generated one", got)
+	}
+}
+
+func TestAccessLogRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	router := httprouter.New()
+	router.GET("/calendar/:token", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {})
+	middlewares.AccessLog(router).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/calendar/s3cr3t", nil))
+
+	if strings.Contains(buf.String(), "s3cr3t") {
+		t.Fatalf("the feed token was logged: %s", buf.String())
+	}
+	var access map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &access)
+	if access["path"] != "/calendar/:token" {
+		t.Errorf("path = %v, want /calendar/:token", access["path"])
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/mailer"
+	"context"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	msg := mailer.Message{To: "alice@example.com", Subject: "Héllo", Body: "line one\nline two"}
+	data := string(mailer.Format("no-reply@example.com", msg, time.Unix(0, 0).UTC()))
+
+	for _, want := range []string{
+		"From: no-reply@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: =?utf-8?q?H=C3=A9llo?=\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message does not contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m, err := mailer.NewFileMailer(dir, "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), mailer.Message{To: "alice@example.com", Subject: "Hi", Body: "body"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got %d messages, want 1", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: alice@example.com") {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
+
+func TestMailerRejectsHeaderInjection(t *testing.T) {
+	m, err := mailer.NewFileMailer(t.TempDir(), "no-reply@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := mailer.Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi", Body: "body"}
+	if err := m.Send(context.Background(), msg); err == nil {
+		t.Error("recipient with a line break was accepted")
+	}
+}
+
+func TestSMTPMailerDeliversToSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go runSMTPSink(ln, received)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	m := mailer.NewSMTPMailer(mailer.SMTPConfig{Host: host, Port: port, From: "no-reply@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, mailer.Message{To: "alice@example.com", Subject: "Hi", Body: "hello\n.leading dot"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-received
+	if !strings.Contains(data, "Subject: Hi") || !strings.Contains(data, "\n.leading dot") {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
+
+// runSMTPSink accepts one SMTP session and sends the message data it received
+func runSMTPSink(ln net.Listener, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 sink")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/utils"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	text := "@alice please check with @bob_1, cc @alice and mail me at someone@example.com"
+	expected := []string{"alice", "bob_1"}
+
+	if mentions := utils.ExtractMentions(text); !reflect.DeepEqual(mentions, expected) {
+		t.Errorf("ExtractMentions returned %v want %v", mentions, expected)
+	}
+}
+
+func TestExtractMentionsAtEndOfSentence(t *testing.T) {
+	cases := map[string][]string{
+		"Thanks @alice.":                {"alice"},
+		"Ask @bob-smith- about it":      {"bob-smith"},
+		"Done by @carol... finally":     {"carol"},
+		"@dave.e, @erin_ and @frank-x.": {"dave.e", "erin_", "frank-x"},
+		"(@grace) and @heidi!":          {"grace", "heidi"},
+		"Nobody here: @. @-":            nil,
+	}
+	for text, expected := range cases {
+		if mentions := utils.ExtractMentions(text); !reflect.DeepEqual(mentions, expected) {
+			t.Errorf("ExtractMentions(%q) returned %v want %v", text, mentions, expected)
+		}
+	}
+}
+
+func TestRenderMarkdownDropsRawHTML(t *testing.T) {
+	html, err := utils.RenderMarkdown("**done** <script>alert(1)</script>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(html, "<strong>done</strong>") {
+		t.Errorf("markdown was not rendered: %s", html)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("raw HTML was rendered: %s", html)
+	}
+}
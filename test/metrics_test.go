@@ -0,0 +1,66 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/metrics"
+	"be-golang-todo/src/middlewares"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func scrape(t *testing.T, handler http.Handler, authorization string) (int, string) {
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	body, _ := io.ReadAll(w.Body)
+	return w.Code, string(body)
+}
+
+func TestMetricsRequests(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/metrics-test/:id", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	handler := middlewares.AccessLog(router)
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test-missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	metrics.CacheLookup("test_cache", true)
+
+	_, body := scrape(t, metrics.Handler(), "")
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/metrics-test/:id",status="202"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"}`,
+		`http_request_duration_seconds_count{method="GET",route="/metrics-test/:id",status="202"} 2`,
+		`cache_lookups_total{cache="test_cache",result="hit"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(body, "/metrics-test/1") {
+		t.Error("metrics are labelled with the raw path")
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	t.Setenv("METRICS_TOKEN", "s3cret")
+	handler := metrics.Handler()
+
+	if code, _ := scrape(t, handler, ""); code != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := scrape(t, handler, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Errorf("with a wrong token: status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := scrape(t, handler, "Bearer s3cret"); code != http.StatusOK {
+		t.Errorf("with the token: status %d, want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,52 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/services/notification"
+	"context"
+	"testing"
+)
+
+func TestNotifyMentions(t *testing.T) {
+	useTestDatabase(t)
+	author := createTestUser(t, account.RoleUser)
+	active := createTestUser(t, account.RoleUser)
+	deleted := createTestUser(t, account.RoleUser)
+	if _, err := database.DB.Exec(`UPDATE "user" SET deleted_at = now() WHERE username = $1`, deleted); err != nil {
+		t.Fatal(err)
+	}
+	id := createTestTask(t, &author)
+
+	mentions := func(username string) int {
+		t.Helper()
+		var count int
+		if err := database.DB.QueryRow("SELECT COUNT(*) FROM notification WHERE username = $1 AND task_id = $2 AND type = $3",
+			username, id, notification.TypeMentioned).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	text := "@" + active + " and @" + deleted + " please look, @" + author + " too"
+	if err := notification.NotifyMentions(context.Background(), author, id, text, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := mentions(active); n != 1 {
+		t.Errorf("%d notifications for the mentioned user, want 1", n)
+	}
+	if n := mentions(deleted); n != 0 {
+		t.Errorf("%d notifications for a deleted account, want 0", n)
+	}
+	if n := mentions(author); n != 0 {
+		t.Errorf("%d notifications for the author, want 0", n)
+	}
+
+	// An edit keeping the mention does not notify again
+	if err := notification.NotifyMentions(context.Background(), author, id, text+" again", text); err != nil {
+		t.Fatal(err)
+	}
+	if n := mentions(active); n != 1 {
+		t.Errorf("%d notifications after an edit, want 1", n)
+	}
+}
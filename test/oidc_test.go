@@ -0,0 +1,142 @@
+package test
+
+import (
+	"be-golang-todo/src/services/oidc"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// mockIdP is a minimal OpenID provider issuing ID tokens for a fixed subject
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "test",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            "todo",
+			"sub":            "user-1",
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"nonce":          idp.nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "test"
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access", "token_type": "Bearer", "expires_in": 60, "id_token": idToken,
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the authorization endpoint, remembering what the ID token must carry
+func (idp *mockIdP) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL without S256 PKCE: %s", authURL)
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+}
+
+func newTestProvider(t *testing.T, idp *mockIdP) *oidc.Provider {
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Name: "mock", Issuer: idp.server.URL, ClientID: "todo", RedirectURL: "http://localhost/oidc/mock/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestOIDCExchangeVerifiesIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+
+	idp.authorize(t, p.AuthURL("state", "nonce-1", "verifier-0123456789-0123456789-0123456789"))
+	claims, err := p.Exchange(context.Background(), "good-code", "verifier-0123456789-0123456789-0123456789", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Issuer != idp.server.URL || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongNonce(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+
+	idp.authorize(t, p.AuthURL("state", "nonce-1", "verifier-0123456789-0123456789-0123456789"))
+	if _, err := p.Exchange(context.Background(), "good-code", "verifier-0123456789-0123456789-0123456789", "nonce-2"); err == nil {
+		t.Error("ID token with another nonce was accepted")
+	}
+}
+
+func TestOIDCExchangeRequiresCodeVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+
+	idp.authorize(t, p.AuthURL("state", "nonce-1", "verifier-0123456789-0123456789-0123456789"))
+	if _, err := p.Exchange(context.Background(), "good-code", "another-verifier-0123456789-0123456789", "nonce-1"); err == nil {
+		t.Error("code was redeemed without the PKCE verifier")
+	}
+}
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/password"
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func rules(violations []password.Violation) []string {
+	var names []string
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPolicyReportsEachRule(t *testing.T) {
+	policy := password.Policy{MinLength: 8, MaxLength: 72, MinClasses: 3, MinScore: 3, RejectUsername: true, Breached: password.EmbeddedBreachedList()}
+
+	cases := []struct {
+		password string
+		username string
+		want     []string
+	}{
+		{"correct horse battery staple 42", "alice", nil},
+		{"Sh0rt!", "alice", []string{password.RuleMinLength, password.RuleStrength}},
+		{"alongpassphrasewithoutanyvariety", "alice", []string{password.RuleCharacterClasses}},
+		{"Alice2024!alice", "alice", []string{password.RuleSimilarUsername, password.RuleStrength}},
+		{"velvet-Canyon-ecila-81", "alice", []string{password.RuleSimilarUsername}},
+		{"password", "alice", []string{password.RuleBreached, password.RuleCharacterClasses, password.RuleStrength}},
+		{strings.Repeat("Ab1!", 20), "alice", []string{password.RuleMaxLength}},
+	}
+	for _, c := range cases {
+		got := rules(policy.Check(c.password, c.username))
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("Check(%q) broke %v, want %v", c.password, got, c.want)
+		}
+	}
+}
+
+func TestPolicyMessages(t *testing.T) {
+	violations := password.Policy{MinLength: 12}.Check("short", "")
+	if len(violations) != 1 || violations[0].Message != "Password must be at least 12 characters" {
+		t.Errorf("unexpected violations %+v", violations)
+	}
+}
+
+func sha1Line(password string, suffix string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:])) + suffix
+}
+
+func TestBreachedListLookup(t *testing.T) {
+	leaked := []string{"hunter2", "letmein", "trustno1", "qwerty", "dragon", "monkey", "123456"}
+	lines := make([]string, 0, len(leaked))
+	for i, p := range leaked {
+		// Counts and Windows line endings as found in downloaded lists
+		lines = append(lines, sha1Line(p, ":"+strings.Repeat("7", i+1)+"\r"))
+	}
+	sort.Strings(lines)
+	list := password.NewBreachedList([]byte(strings.Join(lines, "\n") + "\n"))
+
+	for _, p := range leaked {
+		if found, err := list.Contains(p); err != nil || !found {
+			t.Errorf("Contains(%q) = %v, %v, want true", p, found, err)
+		}
+	}
+	for _, p := range []string{"not leaked at all", "", "Hunter2"} {
+		if found, err := list.Contains(p); err != nil || found {
+			t.Errorf("Contains(%q) = %v, %v, want false", p, found, err)
+		}
+	}
+}
+
+func TestEmbeddedBreachedList(t *testing.T) {
+	list := password.EmbeddedBreachedList()
+	for _, p := range []string{"123456", "password", "qwerty", "zaq12wsx"} {
+		if found, err := list.Contains(p); err != nil || !found {
+			t.Errorf("Contains(%q) = %v, %v, want true", p, found, err)
+		}
+	}
+}
+
+func TestHashVerifiesAndCarriesParams(t *testing.T) {
+	hash, err := password.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("unexpected hash format %q", hash)
+	}
+	if ok, err := password.Verify(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("Verify with the right password = %v, %v", ok, err)
+	}
+	if ok, _ := password.Verify(hash, "wrong horse"); ok {
+		t.Error("Verify accepted a wrong password")
+	}
+	if password.NeedsRehash(hash) {
+		t.Error("a hash with the current parameters needs a rehash")
+	}
+}
+
+func TestLegacyBcryptHashIsVerifiedAndUpgraded(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := password.Verify(string(legacy), "secret pass"); err != nil || !ok {
+		t.Errorf("Verify of a bcrypt hash = %v, %v", ok, err)
+	}
+	if ok, err := password.Verify(string(legacy), "other pass"); err != nil || ok {
+		t.Errorf("Verify of a bcrypt hash with a wrong password = %v, %v", ok, err)
+	}
+	if !password.NeedsRehash(string(legacy)) {
+		t.Error("a bcrypt hash does not need a rehash")
+	}
+}
+
+func TestRaisedCostsNeedRehash(t *testing.T) {
+	hash, err := password.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := password.DefaultParams
+	defer func() { password.DefaultParams = previous }()
+
+	password.DefaultParams.Iterations++
+	if !password.NeedsRehash(hash) {
+		t.Error("a hash with fewer iterations than configured does not need a rehash")
+	}
+	if ok, err := password.Verify(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("an older hash no longer verifies: %v, %v", ok, err)
+	}
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=65536,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=99999999,t=3,p=2$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=2$!!$a2V5",
+	} {
+		if ok, err := password.Verify(hash, "anything"); ok || err == nil {
+			t.Errorf("Verify(%q) = %v, %v, want an error", hash, ok, err)
+		}
+	}
+}
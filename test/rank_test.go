@@ -0,0 +1,58 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/utils"
+	"testing"
+)
+
+func TestRankBetween(t *testing.T) {
+	cases := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"V", ""},
+		{"", "V"},
+		{"", "1"},
+		{"0V", "1"},
+		{"a", "b"},
+		{"az", "b"},
+		{"a0V", "a1"},
+		{"V", "VV"},
+	}
+
+	for _, c := range cases {
+		key, err := utils.RankBetween(c.a, c.b)
+		if err != nil {
+			t.Errorf("RankBetween(%q, %q) returned error: %v", c.a, c.b, err)
+			continue
+		}
+		if (c.a != "" && key <= c.a) || (c.b != "" && key >= c.b) {
+			t.Errorf("RankBetween(%q, %q) = %q, not strictly between", c.a, c.b, key)
+		}
+	}
+}
+
+func TestRankBetweenRepeatedInserts(t *testing.T) {
+	// Always inserting right after the first key must keep producing ordered keys
+	first, _ := utils.RankBetween("", "")
+	last, _ := utils.RankBetween(first, "")
+	upper := last
+	for i := 0; i < 200; i++ {
+		key, err := utils.RankBetween(first, upper)
+		if err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+		if key <= first || key >= upper {
+			t.Fatalf("iteration %d: %q not between %q and %q", i, key, first, upper)
+		}
+		upper = key
+	}
+}
+
+func TestRankBetweenInvalid(t *testing.T) {
+	for _, c := range [][2]string{{"b", "a"}, {"a", "a"}, {"a0", ""}, {"a-", ""}} {
+		if _, err := utils.RankBetween(c[0], c[1]); err != utils.ErrInvalidRank {
+			t.Errorf("RankBetween(%q, %q) should be invalid, got %v", c[0], c[1], err)
+		}
+	}
+}
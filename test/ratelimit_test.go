@@ -0,0 +1,66 @@
+package test
+
+import (
+	"be-golang-todo/src/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRateLimit(t *testing.T) {
+	limit := middlewares.Limit{Name: "test-burst", Requests: 3, Window: time.Hour, Key: middlewares.ByIP}
+	handler := middlewares.RateLimit(limit, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	request := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler(w, r, nil)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		w := request("192.0.2.1:1234")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != []string{"2", "1", "0"}[i] {
+			t.Errorf("request %d: RateLimit-Remaining = %q", i+1, got)
+		}
+	}
+
+	w := request("192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After is missing")
+	}
+	if got := w.Header().Get("RateLimit-Policy"); got != "3;w=3600" {
+		t.Errorf("RateLimit-Policy = %q", got)
+	}
+
+	// Other clients have their own quota
+	if w := request("192.0.2.2:1234"); w.Code != http.StatusNoContent {
+		t.Errorf("other client: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	t.Setenv("RATE_LIMIT_TEST_OFF", "off")
+	limit := middlewares.Limit{Name: "test-off", Requests: 1, Window: time.Minute}
+	handler := middlewares.RateLimit(limit, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {})
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/tasks", nil), nil)
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	"strings"
+	"testing"
+)
+
+func TestHasScope(t *testing.T) {
+	cases := []struct {
+		granted  []string
+		required string
+		want     bool
+	}{
+		{[]string{"tasks:read"}, "tasks:read", true},
+		{[]string{"tasks:write"}, "tasks:read", true},
+		{[]string{"tasks:read"}, "tasks:write", false},
+		{[]string{"time:write"}, "tasks:read", false},
+		{[]string{"admin:read", "tasks:write"}, "admin:read", true},
+		{nil, "tasks:read", false},
+	}
+
+	for _, c := range cases {
+		if got := account.HasScope(c.granted, c.required); got != c.want {
+			t.Errorf("HasScope(%v, %q) = %v, want %v", c.granted, c.required, got, c.want)
+		}
+	}
+}
+
+func TestNewTokenIsStoredAsHash(t *testing.T) {
+	token, hash, err := account.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, account.TokenPrefix) {
+		t.Errorf("token %q lacks the %q prefix", token, account.TokenPrefix)
+	}
+	if hash == token || strings.Contains(hash, token) {
+		t.Errorf("hash %q reveals the token", hash)
+	}
+}
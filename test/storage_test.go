@@ -0,0 +1,232 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/storage"
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "sha256/ab/abcdef"
+
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("blob should exist: %v %v", exists, err)
+	}
+
+	blob, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(content) != "hello" {
+		t.Errorf("unexpected content: %q", content)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, key); err != storage.ErrNotFound {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Error("keys escaping the root must be rejected")
+	}
+}
+
+// fakeS3 answers the few path-style S3 calls the store makes, keeping objects in memory
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]bool{}, objects: map[string][]byte{}, types: map[string]string{}}
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			if !s.buckets[bucket] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case http.MethodPut:
+			s.buckets[bucket] = true
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+	if !s.buckets[bucket] {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	name := bucket + "/" + key
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readS3Payload(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[name] = body
+		s.types[name] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodHead, http.MethodGet:
+		body, ok := s.objects[name]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Type", s.types[name])
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(body)
+		}
+	case http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// readS3Payload reads an upload, decoding the aws-chunked encoding of streaming signatures
+func readS3Payload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var body bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return body.Bytes(), nil
+		}
+		if _, err := io.CopyN(&body, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code><Message>"+code+"</Message></Error>")
+}
+
+func TestS3Store(t *testing.T) {
+	server := httptest.NewServer(newFakeS3())
+	defer server.Close()
+
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+		Bucket:    "attachments",
+		Region:    "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "sha256/ab/abcdef"
+
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Fatalf("blob should not exist yet: %v %v", exists, err)
+	}
+	if _, err := store.Get(ctx, key); err != storage.ErrNotFound {
+		t.Errorf("expected ErrNotFound before put, got %v", err)
+	}
+
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("blob should exist: %v %v", exists, err)
+	}
+
+	blob, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(content) != "hello" {
+		t.Errorf("unexpected content: %q", content)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Errorf("blob should be gone after delete: %v %v", exists, err)
+	}
+	if _, err := store.Get(ctx, key); err != storage.ErrNotFound {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestSignedDownload(t *testing.T) {
+	storage.SetSigningKey([]byte("test-key"))
+
+	query := storage.SignDownload("attachment:1", time.Now().Add(time.Minute))
+	parts := strings.Split(query, "&")
+	expires := strings.TrimPrefix(parts[0], "expires=")
+	signature := strings.TrimPrefix(parts[1], "signature=")
+
+	if !storage.VerifyDownload("attachment:1", expires, signature) {
+		t.Error("valid signature was rejected")
+	}
+	if storage.VerifyDownload("attachment:2", expires, signature) {
+		t.Error("signature was accepted for another resource")
+	}
+
+	expired := storage.SignDownload("attachment:1", time.Now().Add(-time.Minute))
+	parts = strings.Split(expired, "&")
+	if storage.VerifyDownload("attachment:1", strings.TrimPrefix(parts[0], "expires="), strings.TrimPrefix(parts[1], "signature=")) {
+		t.Error("expired signature was accepted")
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/services/task"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type syncResponse struct {
+	Tasks []struct {
+		ID int `json:"id"`
+	} `json:"tasks"`
+	Deleted []int  `json:"deleted"`
+	Token   string `json:"token"`
+}
+
+func getSync(t *testing.T, username string, since string) syncResponse {
+	t.Helper()
+	r := asUser(httptest.NewRequest("GET", "/sync?since="+since, nil), username, account.RoleUser)
+	w := httptest.NewRecorder()
+	task.GetSyncHandler(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /sync: status %d, %s", w.Code, w.Body.String())
+	}
+	var response syncResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestSyncSendsPurgedTasksAsDeleted(t *testing.T) {
+	useTestDatabase(t)
+	owner := createTestUser(t, account.RoleUser)
+	id := createTestTask(t, &owner)
+
+	token := getSync(t, owner, "").Token
+
+	r := asUser(httptest.NewRequest("DELETE", "/tasks/"+strconv.Itoa(id)+"?purge=true", nil), owner, account.RoleUser)
+	r.Header.Set("If-Match", "*")
+	w := httptest.NewRecorder()
+	task.DeleteTaskHandler(w, r, httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("purge: status %d, %s", w.Code, w.Body.String())
+	}
+
+	changes := getSync(t, owner, token)
+	found := false
+	for _, deleted := range changes.Deleted {
+		found = found || deleted == id
+	}
+	if !found {
+		t.Errorf("the purged task %d is not among the deleted %v", id, changes.Deleted)
+	}
+
+	// Someone who never saw the task does not hear of it
+	other := createTestUser(t, account.RoleUser)
+	for _, deleted := range getSync(t, other, token).Deleted {
+		if deleted == id {
+			t.Error("the purged task was sent to a user who could not see it")
+		}
+	}
+}
+
+func TestSyncSendsTasksWithoutCreator(t *testing.T) {
+	useTestDatabase(t)
+	username := createTestUser(t, account.RoleUser)
+	id := createTestTask(t, nil)
+
+	// Everyone owns a task that predates created_by, so everyone syncs it
+	access, err := task.AccessFor(context.Background(), id, username)
+	if err != nil || access != task.AccessOwner {
+		t.Fatalf("AccessFor = %d, %v, want AccessOwner", access, err)
+	}
+	found := false
+	for _, synced := range getSync(t, username, "").Tasks {
+		found = found || synced.ID == id
+	}
+	if !found {
+		t.Errorf("the task %d without a creator was not synced", id)
+	}
+}
@@ -1,9 +1,15 @@
 package test
 
 import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
 	"be-golang-todo/src/services/task"
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/julienschmidt/httprouter"
@@ -70,3 +76,88 @@ func TestGetAllTaskPaginateHandler(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestTaskAccessLevels(t *testing.T) {
+	useTestDatabase(t)
+	owner := createTestUser(t, account.RoleUser)
+	assignee := createTestUser(t, account.RoleUser)
+	stranger := createTestUser(t, account.RoleUser)
+	id := createTestTask(t, &owner)
+	if _, err := database.DB.Exec("INSERT INTO task_assignee (task_id, username, assigned_by) VALUES ($1, $2, $3)", id, assignee, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	for username, want := range map[string]int{owner: task.AccessOwner, assignee: task.AccessAssignee, stranger: task.AccessNone} {
+		if access, err := task.AccessFor(context.Background(), id, username); err != nil || access != want {
+			t.Errorf("AccessFor(%s) = %d, %v, want %d", username, access, err, want)
+		}
+	}
+
+	getTask := func(username string) int {
+		r := asUser(httptest.NewRequest("GET", "/tasks/"+strconv.Itoa(id), nil), username, account.RoleUser)
+		w := httptest.NewRecorder()
+		task.GetDetailTaskHandler(w, r, httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}})
+		return w.Code
+	}
+	for username, want := range map[string]int{owner: http.StatusOK, assignee: http.StatusOK, stranger: http.StatusNotFound} {
+		if code := getTask(username); code != want {
+			t.Errorf("GET /tasks/:id as %s: status %d, want %d", username, code, want)
+		}
+	}
+
+	// Assignees can move a task along but not delete it
+	r := asUser(httptest.NewRequest("DELETE", "/tasks/"+strconv.Itoa(id), nil), assignee, account.RoleUser)
+	r.Header.Set("If-Match", "*")
+	w := httptest.NewRecorder()
+	task.DeleteTaskHandler(w, r, httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("DELETE as the assignee: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	if _, err := database.DB.Exec("UPDATE task SET deleted_at = now() WHERE id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	if code := getTask(owner); code != http.StatusNotFound {
+		t.Errorf("GET /tasks/:id of a deleted task: status %d, want %d", code, http.StatusNotFound)
+	}
+	if _, err := task.AccessFor(context.Background(), id, owner); err != task.ErrTaskNotFound {
+		t.Errorf("AccessFor of a deleted task: %v, want ErrTaskNotFound", err)
+	}
+}
+
+func TestTasksAssignedToMe(t *testing.T) {
+	useTestDatabase(t)
+	useTestRedis(t)
+	owner := createTestUser(t, account.RoleUser)
+	assignee := createTestUser(t, account.RoleUser)
+	assigned := createTestTask(t, &owner)
+	createTestTask(t, &owner)
+
+	r := asUser(httptest.NewRequest("POST", "/tasks/"+strconv.Itoa(assigned)+"/assignees", strings.NewReader(`{"usernames": ["`+assignee+`"]}`)), owner, account.RoleUser)
+	w := httptest.NewRecorder()
+	task.AssignTaskHandler(w, r, httprouter.Params{{Key: "id", Value: strconv.Itoa(assigned)}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("assign: status %d, %s", w.Code, w.Body.String())
+	}
+
+	r = asUser(httptest.NewRequest("GET", "/tasks?assignee=me", nil), assignee, account.RoleUser)
+	w = httptest.NewRecorder()
+	task.GetAllTaskPaginationHandler(w, r, nil)
+	var response struct {
+		Tasks []struct{ ID int }
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Tasks) != 1 || response.Tasks[0].ID != assigned {
+		t.Errorf("GET /tasks?assignee=me returned %v, want only task %d", response.Tasks, assigned)
+	}
+
+	// Assigning someone who does not exist is refused as a whole
+	r = asUser(httptest.NewRequest("POST", "/tasks/"+strconv.Itoa(assigned)+"/assignees", strings.NewReader(`{"usernames": ["no_such_user_`+owner+`"]}`)), owner, account.RoleUser)
+	w = httptest.NewRecorder()
+	task.AssignTaskHandler(w, r, httprouter.Params{{Key: "id", Value: strconv.Itoa(assigned)}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("assigning an unknown user: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	"be-golang-todo/src/services/timeentry"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestOneRunningTimerPerUser(t *testing.T) {
+	useTestDatabase(t)
+	username := createTestUser(t, account.RoleUser)
+	first := createTestTask(t, &username)
+	second := createTestTask(t, &username)
+
+	timer := func(handle httprouter.Handle, id int) int {
+		w := httptest.NewRecorder()
+		handle(w, asUser(httptest.NewRequest("POST", "/tasks/"+strconv.Itoa(id)+"/timer", nil), username, account.RoleUser),
+			httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}})
+		return w.Code
+	}
+
+	if code := timer(timeentry.StartTimerHandler, first); code != http.StatusCreated {
+		t.Fatalf("start: status %d, want %d", code, http.StatusCreated)
+	}
+	if code := timer(timeentry.StartTimerHandler, second); code != http.StatusConflict {
+		t.Errorf("start a second timer: status %d, want %d", code, http.StatusConflict)
+	}
+	if code := timer(timeentry.StartTimerHandler, first); code != http.StatusConflict {
+		t.Errorf("start the same timer again: status %d, want %d", code, http.StatusConflict)
+	}
+
+	w := httptest.NewRecorder()
+	timeentry.GetRunningTimerHandler(w, asUser(httptest.NewRequest("GET", "/timer", nil), username, account.RoleUser), nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"TaskID":`+strconv.Itoa(first)) {
+		t.Errorf("running timer: status %d, %s", w.Code, w.Body.String())
+	}
+
+	if code := timer(timeentry.StopTimerHandler, second); code != http.StatusNotFound {
+		t.Errorf("stop a task without a timer: status %d, want %d", code, http.StatusNotFound)
+	}
+	if code := timer(timeentry.StopTimerHandler, first); code != http.StatusOK {
+		t.Errorf("stop: status %d, want %d", code, http.StatusOK)
+	}
+	if code := timer(timeentry.StartTimerHandler, second); code != http.StatusCreated {
+		t.Errorf("start after stopping: status %d, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestTimeReportCSV(t *testing.T) {
+	useTestDatabase(t)
+	username := createTestUser(t, account.RoleUser)
+	id := createTestTask(t, &username)
+	ps := httprouter.Params{{Key: "id", Value: strconv.Itoa(id)}}
+
+	for _, body := range []string{
+		`{"started_at": "2024-03-01T09:00:00Z", "minutes": 30}`,
+		`{"started_at": "2024-03-01T14:00:00Z", "minutes": 60}`,
+		`{"started_at": "2024-03-02T09:00:00Z", "minutes": 45}`,
+		// Outside the range
+		`{"started_at": "2024-03-05T09:00:00Z", "minutes": 15}`,
+	} {
+		w := httptest.NewRecorder()
+		timeentry.CreateTimeEntryHandler(w, asUser(httptest.NewRequest("POST", "/tasks/"+strconv.Itoa(id)+"/time-entries", strings.NewReader(body)), username, account.RoleUser), ps)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d, %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	timeentry.GetTimeReportHandler(w, asUser(httptest.NewRequest("GET", "/time-report?group_by=date&from=2024-03-01&to=2024-03-02&format=csv", nil), username, account.RoleUser), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("report: status %d, %s", w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/csv") {
+		t.Errorf("Content-Type %q, want text/csv", contentType)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="time-report-20240301-20240302.csv"` {
+		t.Errorf("Content-Disposition %q", disposition)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"date", "label", "entries", "minutes", "hours"},
+		{"2024-03-01", "2024-03-01", "2", "90.0", "1.50"},
+		{"2024-03-02", "2024-03-02", "1", "45.0", "0.75"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("report %v, want %v", records, want)
+	}
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	config "be-golang-todo/src/helper/redis"
+	"be-golang-todo/src/helper/twofactor"
+	"be-golang-todo/src/helper/utils"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pquerna/otp/totp"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func codeAt(t *testing.T, at time.Time) string {
+	code, err := totp.GenerateCode(testTOTPSecret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestMatchingStepAllowsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	current := now.Unix() / 30
+
+	cases := map[time.Duration]int64{
+		0:                 current,
+		-30 * time.Second: current - 1,
+		30 * time.Second:  current + 1,
+		-60 * time.Second: -1,
+		90 * time.Second:  -1,
+	}
+	for drift, want := range cases {
+		if got := twofactor.MatchingStep(testTOTPSecret, codeAt(t, now.Add(drift)), now, -1); got != want {
+			t.Errorf("code %v away: step %d, want %d", drift, got, want)
+		}
+	}
+	if got := twofactor.MatchingStep(testTOTPSecret, "000000x", now, -1); got != -1 {
+		t.Errorf("malformed code matched step %d", got)
+	}
+}
+
+func TestMatchingStepRejectsReplays(t *testing.T) {
+	now := time.Unix(1_700_000_010, 0)
+	code := codeAt(t, now)
+
+	step := twofactor.MatchingStep(testTOTPSecret, code, now, -1)
+	if step < 0 {
+		t.Fatal("the current code did not match")
+	}
+	if got := twofactor.MatchingStep(testTOTPSecret, code, now, step); got != -1 {
+		t.Errorf("the code of the last accepted step matched again, step %d", got)
+	}
+	// An earlier code is no good once a later one was accepted
+	if got := twofactor.MatchingStep(testTOTPSecret, codeAt(t, now.Add(-30*time.Second)), now, step); got != -1 {
+		t.Errorf("an older code matched after a newer one, step %d", got)
+	}
+	if got := twofactor.MatchingStep(testTOTPSecret, codeAt(t, now.Add(30*time.Second)), now, step); got != step+1 {
+		t.Errorf("the next code: step %d, want %d", got, step+1)
+	}
+}
+
+func TestSecretEncryptionRoundTrip(t *testing.T) {
+	t.Setenv("MFA_ENCRYPTION_KEY", "first key")
+	sealed, err := twofactor.EncryptSecret(testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, testTOTPSecret) {
+		t.Fatal("the sealed secret contains the secret")
+	}
+	again, _ := twofactor.EncryptSecret(testTOTPSecret)
+	if again == sealed {
+		t.Error("sealing twice gave the same output, the nonce is not random")
+	}
+
+	secret, err := twofactor.DecryptSecret(sealed)
+	if err != nil || secret != testTOTPSecret {
+		t.Fatalf("DecryptSecret = %q, %v, want the secret back", secret, err)
+	}
+
+	t.Setenv("MFA_ENCRYPTION_KEY", "second key")
+	if _, err := twofactor.DecryptSecret(sealed); err == nil {
+		t.Error("a secret opened under another key")
+	}
+	if _, err := twofactor.DecryptSecret("bm9wZQ"); err == nil {
+		t.Error("a malformed secret opened")
+	}
+
+	t.Setenv("MFA_ENCRYPTION_KEY", "")
+	if _, err := twofactor.EncryptSecret(testTOTPSecret); err != twofactor.ErrEncryptionKeyMissing {
+		t.Errorf("no key: error %v, want ErrEncryptionKeyMissing", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := twofactor.NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != twofactor.RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), twofactor.RecoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("code %q is not formatted like abcde-fghij", code)
+		}
+		if !twofactor.IsRecoveryCode(code) {
+			t.Errorf("code %q is not taken for a recovery code", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q was issued twice", code)
+		}
+		seen[code] = true
+	}
+
+	// Codes are typed back in all sorts of ways
+	for _, typed := range []string{"abcde-fghij", "ABCDE-FGHIJ", "abcdefghij", "abcde fghij", " abcde-fghij "} {
+		if got := twofactor.NormalizeRecoveryCode(typed); got != "abcdefghij" {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q", typed, got)
+		}
+	}
+	if twofactor.IsRecoveryCode("123456") {
+		t.Error("a TOTP code is taken for a recovery code")
+	}
+}
+
+// TestTakeLoginAttemptIsExhausted needs a Redis server, at TEST_REDIS_ADDR
+func TestTakeLoginAttemptIsExhausted(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR is not set")
+	}
+	previous := config.RDB
+	config.RDB = redis.NewClient(&redis.Options{Addr: addr})
+	defer func() {
+		config.RDB.Close()
+		config.RDB = previous
+	}()
+
+	id, _ := utils.RandomToken(16)
+	if err := twofactor.StartLoginAttempts(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < twofactor.MaxLoginAttempts; i++ {
+		if ok, err := twofactor.TakeLoginAttempt(context.Background(), id); !ok || err != nil {
+			t.Fatalf("attempt %d: %v, %v, want it allowed", i+1, ok, err)
+		}
+	}
+	if ok, err := twofactor.TakeLoginAttempt(context.Background(), id); ok || err != nil {
+		t.Fatalf("attempt past the limit: %v, %v, want it refused", ok, err)
+	}
+	if ok, _ := twofactor.TakeLoginAttempt(context.Background(), id); ok {
+		t.Error("an exhausted token allowed another attempt")
+	}
+
+	// A finished login leaves no attempts either
+	twofactor.StartLoginAttempts(context.Background(), id)
+	if err := twofactor.FinishLogin(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := twofactor.TakeLoginAttempt(context.Background(), id); ok {
+		t.Error("a finished login allowed another attempt")
+	}
+}
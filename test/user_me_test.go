@@ -0,0 +1,169 @@
+package test
+
+import (
+	"be-golang-todo/src/helper/account"
+	database "be-golang-todo/src/helper/db"
+	"be-golang-todo/src/helper/session"
+	"be-golang-todo/src/helper/utils"
+	"be-golang-todo/src/services/user"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChangePasswordReplacesSessions(t *testing.T) {
+	useTestDatabase(t)
+	useTestRedis(t)
+	username := createTestUser(t, account.RoleUser)
+	setTestPassword(t, username, "first correct horse battery")
+	ctx := context.Background()
+
+	login := asUser(httptest.NewRequest("POST", "/login", nil), username, account.RoleUser)
+	for range 2 {
+		if _, err := session.Issue(login, username, account.RoleUser); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := session.List(ctx, username, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 2 {
+		t.Fatalf("%d sessions before the change, want 2", len(before))
+	}
+
+	change := func(current string, next string) *httptest.ResponseRecorder {
+		body := `{"current_password": "` + current + `", "new_password": "` + next + `"}`
+		w := httptest.NewRecorder()
+		user.ChangePasswordHandler(w, asUser(httptest.NewRequest("PUT", "/me/password", strings.NewReader(body)), username, account.RoleUser), nil)
+		return w
+	}
+
+	if w := change("wrong password", "second purple staple lantern"); w.Code != http.StatusForbidden {
+		t.Errorf("a wrong current password: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if sessions, _ := session.List(ctx, username, ""); len(sessions) != 2 {
+		t.Errorf("%d sessions after a refused change, want 2", len(sessions))
+	}
+
+	w := change("first correct horse battery", "second purple staple lantern")
+	if w.Code != http.StatusOK {
+		t.Fatalf("change: status %d, %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.DecodeToken(response.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, _ := claims["sid"].(string)
+
+	// The old sessions are revoked, the token returned belongs to the only active one
+	after, err := session.List(ctx, username, sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 1 || !after[0].Current {
+		t.Fatalf("sessions after the change: %+v, want the new one alone", after)
+	}
+	for _, old := range before {
+		if old.ID == after[0].ID {
+			t.Error("an old session survived the change")
+		}
+	}
+	if active, err := session.Active(ctx, sid, username, ""); err != nil || !active {
+		t.Errorf("the new session is not active: %v", err)
+	}
+	var revoked int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM user_session WHERE username = $1 AND revoked_at IS NOT NULL", username).Scan(&revoked); err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 2 {
+		t.Errorf("%d revoked sessions, want 2", revoked)
+	}
+
+	if w := change("first correct horse battery", "third quiet orange bicycle"); w.Code != http.StatusForbidden {
+		t.Errorf("the old password still works: status %d", w.Code)
+	}
+}
+
+func TestDeleteMeLeavesTombstone(t *testing.T) {
+	useTestDatabase(t)
+	useTestRedis(t)
+	username := createTestUser(t, account.RoleUser)
+	other := createTestUser(t, account.RoleUser)
+	setTestPassword(t, username, "correct horse battery staple")
+	t.Setenv("ACCOUNT_DELETION_TASKS", "")
+
+	own := createTestTask(t, &username)
+	shared := createTestTask(t, &username)
+	assigned := createTestTask(t, &other)
+	for _, assignment := range []struct {
+		task     int
+		username string
+	}{{shared, other}, {assigned, username}} {
+		if _, err := database.DB.Exec("INSERT INTO task_assignee (task_id, username, assigned_by) VALUES ($1, $2, $3)",
+			assignment.task, assignment.username, username); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := session.Issue(asUser(httptest.NewRequest("POST", "/login", nil), username, account.RoleUser), username, account.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	remove := func(body string) int {
+		w := httptest.NewRecorder()
+		user.DeleteMeHandler(w, asUser(httptest.NewRequest("DELETE", "/me", strings.NewReader(body)), username, account.RoleUser), nil)
+		return w.Code
+	}
+	if code := remove(`{"password": "wrong"}`); code != http.StatusForbidden {
+		t.Errorf("delete with a wrong password: status %d, want %d", code, http.StatusForbidden)
+	}
+	if code := remove(`{"password": "correct horse battery staple"}`); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d, want %d", code, http.StatusNoContent)
+	}
+
+	// The row stays to keep the username reserved, without credentials
+	var deleted, disabled bool
+	var password string
+	if err := database.DB.QueryRow(`SELECT deleted_at IS NOT NULL, disabled_at IS NOT NULL, password FROM "user" WHERE username = $1`,
+		username).Scan(&deleted, &disabled, &password); err != nil {
+		t.Fatal(err)
+	}
+	if !deleted || !disabled || password != "" {
+		t.Errorf("tombstone deleted %v, disabled %v, password %q", deleted, disabled, password)
+	}
+	if sessions, _ := session.List(context.Background(), username, ""); len(sessions) != 0 {
+		t.Errorf("%d sessions left", len(sessions))
+	}
+	var assignments int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM task_assignee WHERE username = $1", username).Scan(&assignments); err != nil {
+		t.Fatal(err)
+	}
+	if assignments != 0 {
+		t.Errorf("%d assignments left", assignments)
+	}
+
+	// By default tasks nobody else is assigned to go, shared ones stay
+	taskDeleted := func(id int) bool {
+		t.Helper()
+		var deleted bool
+		if err := database.DB.QueryRow("SELECT deleted_at IS NOT NULL FROM task WHERE id = $1", id).Scan(&deleted); err != nil {
+			t.Fatal(err)
+		}
+		return deleted
+	}
+	if !taskDeleted(own) {
+		t.Error("an unshared task survived the account")
+	}
+	if taskDeleted(shared) || taskDeleted(assigned) {
+		t.Error("a shared task was deleted with the account")
+	}
+}